@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+)
+
+// Key is one key of the keyset. Private is only set for keys that can sign.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// KeyConfig is an entry of JWT_KEYS: a key ID and the PEM file holding
+// either a private key or, for keys only kept to verify, a public key
+type KeyConfig struct {
+	Kid  string `mapstructure:"kid"`
+	File string `mapstructure:"file"`
+}
+
+// keyset holds the asymmetric keys. When it is empty tokens are signed with
+// JWT_SECRET using HS256.
+var keyset struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string
+}
+
+// InitKeys loads the keys listed in JWT_KEYS and picks JWT_SIGNING_KID to
+// sign new tokens. The other keys still verify tokens signed before a
+// rotation until they are removed from the config.
+func InitKeys() {
+	var configs []KeyConfig
+	if err := viper.UnmarshalKey("JWT_KEYS", &configs); err != nil {
+		log.Fatal("Invalid JWT_KEYS:", err)
+	}
+	if len(configs) == 0 {
+		return
+	}
+
+	keys := map[string]*Key{}
+	var order []string
+	for _, config := range configs {
+		if config.Kid == "" {
+			log.Fatal("JWT_KEYS entry is missing a kid")
+		}
+		if _, ok := keys[config.Kid]; ok {
+			log.Fatal("Duplicate kid in JWT_KEYS:", config.Kid)
+		}
+
+		key, err := LoadKey(config.Kid, config.File)
+		if err != nil {
+			log.Fatal("Failed to load JWT key:", err)
+		}
+		keys[key.ID] = key
+		order = append(order, key.ID)
+	}
+
+	kid := viper.GetString("JWT_SIGNING_KID")
+	if kid == "" {
+		kid = order[0]
+	}
+	signing, ok := keys[kid]
+	if !ok || signing.Private == nil {
+		log.Fatal("JWT_SIGNING_KID must name a private key in JWT_KEYS:", kid)
+	}
+
+	keyset.signing = signing
+	keyset.keys = keys
+	keyset.order = order
+}
+
+// LoadKey reads an RSA, ECDSA or Ed25519 key from a PEM file. The signing
+// algorithm follows from the key: RS256, ES256/ES384/ES512 by curve, or EdDSA.
+func LoadKey(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	key := &Key{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Private, key.Public = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key.Private, key.Public = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Private, key.Public = k, k.Public()
+	default:
+		key.Public = k
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("%s: unsupported curve", path)
+		}
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, pub)
+	}
+
+	return key, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public half of every key in the keyset. It is empty
+// when tokens are signed with the shared secret.
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, kid := range keyset.order {
+		key := keyset.keys[kid]
+		jwk := JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBase64(pub.N.Bytes())
+			jwk.E = encodeBase64(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = encodeBase64(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = encodeBase64(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encodeBase64(pub)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PublicKey decodes a JWK into the public key and the signing method it is
+// used with
+func (k JWK) PublicKey() (crypto.PublicKey, jwt.SigningMethod, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, nil, err
+		}
+		method := jwt.GetSigningMethod(k.Alg)
+		if _, ok := method.(*jwt.SigningMethodRSA); !ok {
+			method = jwt.SigningMethodRS256
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return key, method, nil
+	case "EC":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := &ecdsa.PublicKey{X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		var method jwt.SigningMethod
+		switch k.Crv {
+		case "P-256":
+			key.Curve, method = elliptic.P256(), jwt.SigningMethodES256
+		case "P-384":
+			key.Curve, method = elliptic.P384(), jwt.SigningMethodES384
+		case "P-521":
+			key.Curve, method = elliptic.P521(), jwt.SigningMethodES512
+		default:
+			return nil, nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, nil, errors.New("invalid EC key")
+		}
+		return key, method, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// signingKey returns the method, key and kid new tokens are signed with
+func signingKey() (jwt.SigningMethod, interface{}, string, error) {
+	if keyset.signing != nil {
+		return keyset.signing.Method, keyset.signing.Private, keyset.signing.ID, nil
+	}
+
+	key, err := secret()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return jwt.SigningMethodHS256, key, "", nil
+}
+
+// verificationKey finds the key a token was signed with by its kid. The
+// token's alg must be the key's own, so a public key can never be used as an
+// HMAC secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keyset.keys == nil {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret()
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keyset.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method != key.Method {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
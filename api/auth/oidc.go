@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+)
+
+// OIDCProvider is the OpenID Connect identity provider set by OIDC_ISSUER.
+// Its endpoints are discovered on first use and its signing keys are
+// refetched when an ID token names a key we haven't seen.
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	client *http.Client
+
+	mu         sync.Mutex
+	discovery  *oidcDiscovery
+	keys       map[string]oidcKey
+	keysLoaded time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcKey struct {
+	key    crypto.PublicKey
+	method jwt.SigningMethod
+}
+
+// IDToken is the identity asserted by a verified ID token
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// keyRefreshInterval limits how often an unknown kid makes us refetch the
+// provider's keys
+const keyRefreshInterval = time.Minute
+
+var (
+	oidcOnce     sync.Once
+	oidcProvider *OIDCProvider
+)
+
+// OIDC returns the configured provider, or nil when OIDC_ISSUER is unset.
+// redirectURL is used when OIDC_REDIRECT_URL isn't configured.
+func OIDC(redirectURL string) *OIDCProvider {
+	oidcOnce.Do(func() {
+		issuer := strings.TrimSuffix(viper.GetString("OIDC_ISSUER"), "/")
+		if issuer == "" {
+			return
+		}
+
+		scopes := viper.GetStringSlice("OIDC_SCOPES")
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+		if configured := viper.GetString("OIDC_REDIRECT_URL"); configured != "" {
+			redirectURL = configured
+		}
+
+		oidcProvider = &OIDCProvider{
+			Issuer:       issuer,
+			ClientID:     viper.GetString("OIDC_CLIENT_ID"),
+			ClientSecret: viper.GetString("OIDC_CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+			client:       &http.Client{Timeout: 10 * time.Second},
+		}
+	})
+	return oidcProvider
+}
+
+// getJSON fetches a JSON document from the provider
+func (p *OIDCProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// endpoints returns the provider's discovery document, fetching it once
+func (p *OIDCProvider) endpoints() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// signingKey finds the provider key an ID token was signed with
+func (p *OIDCProvider) signingKey(kid string) (*oidcKey, error) {
+	discovery, err := p.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return &key, nil
+	}
+	if time.Since(p.keysLoaded) < keyRefreshInterval {
+		return nil, errors.New("unknown signing key")
+	}
+
+	var set JWKSet
+	if err := p.getJSON(discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching OIDC keys failed: %v", err)
+	}
+
+	keys := map[string]oidcKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, method, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = oidcKey{key: key, method: method}
+	}
+	p.keys = keys
+	p.keysLoaded = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return &key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// NewPKCE returns a PKCE code verifier and its S256 challenge
+func NewPKCE() (verifier, challenge string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL is where the browser is sent to sign in at the provider
+func (p *OIDCProvider) AuthCodeURL(state, nonce, challenge string) (string, error) {
+	discovery, err := p.endpoints()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades an authorization code for the provider's ID token
+func (p *OIDCProvider) Exchange(code, verifier string) (string, error) {
+	discovery, err := p.endpoints()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	resp, err := p.client.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return "", fmt.Errorf("OIDC token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("OIDC token response invalid: %v", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("OIDC token request failed: %s %s", result.Error, result.ErrorDescription)
+	}
+	if result.IDToken == "" {
+		return "", errors.New("OIDC token response has no id_token")
+	}
+
+	return result.IDToken, nil
+}
+
+// VerifyIDToken checks an ID token's signature against the provider's keys
+// and its issuer, audience, times and nonce, then returns the identity in it.
+// groupsClaim names the claim listing the user's groups.
+func (p *OIDCProvider) VerifyIDToken(raw, nonce, groupsClaim string) (*IDToken, error) {
+	discovery, err := p.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	_, err = parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.signingKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method != key.method {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	skew := int64(clockSkew().Seconds())
+
+	if !claims.VerifyIssuer(discovery.Issuer, true) {
+		return nil, jwt.ErrTokenInvalidIssuer
+	}
+	if !claims.VerifyAudience(p.ClientID, true) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.ClientID {
+		return nil, errors.New("ID token was issued to another client")
+	}
+	if !claims.VerifyExpiresAt(now-skew, true) {
+		return nil, jwt.ErrTokenExpired
+	}
+	if !claims.VerifyIssuedAt(now+skew, true) {
+		return nil, jwt.ErrTokenUsedBeforeIssued
+	}
+	if !claims.VerifyNotBefore(now+skew, false) {
+		return nil, jwt.ErrTokenNotValidYet
+	}
+	if claims["nonce"] != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	id := &IDToken{}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = verified
+	case string:
+		id.EmailVerified = verified == "true"
+	}
+	switch groups := claims[groupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				id.Groups = append(id.Groups, name)
+			}
+		}
+	case string:
+		id.Groups = []string{groups}
+	}
+
+	if id.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const mockClientID = "library"
+
+// mockOIDC is a minimal OpenID Connect provider serving discovery, JWKS and
+// the token endpoint. Codes are handed out by authorize and redeemed once
+// with the matching PKCE verifier.
+type mockOIDC struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockOIDC{t: t, key: key, kid: "mock-key", codes: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	// Served under another path so a provider configured with the wrong
+	// issuer gets a document naming this one
+	mux.HandleFunc("/other/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDC) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Issuer:      m.server.URL,
+		ClientID:    mockClientID,
+		RedirectURL: "http://app.test/login/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+		client:      m.server.Client(),
+	}
+}
+
+func (m *mockOIDC) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(oidcDiscovery{
+		Issuer:                m.server.URL,
+		AuthorizationEndpoint: m.server.URL + "/authorize",
+		TokenEndpoint:         m.server.URL + "/token",
+		JWKSURI:               m.server.URL + "/jwks",
+	})
+}
+
+func (m *mockOIDC) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: m.kid,
+		N:   encodeBase64(pub.N.Bytes()),
+		E:   encodeBase64(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	if r.FormValue("grant_type") != "authorization_code" || r.FormValue("client_id") != mockClientID {
+		fail("invalid_request")
+		return
+	}
+
+	m.mu.Lock()
+	grant, ok := m.codes[r.FormValue("code")]
+	delete(m.codes, r.FormValue("code"))
+	m.mu.Unlock()
+	if !ok {
+		fail("invalid_grant")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(grant.claims)})
+}
+
+// authorize signs the user in at the provider for an authorization URL and
+// returns the code the browser would bring back. edit changes the ID token
+// claims the code redeems for.
+func (m *mockOIDC) authorize(authURL string, edit func(jwt.MapClaims)) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		m.t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            q.Get("client_id"),
+		"sub":            "user-1",
+		"email":          "reader@example.com",
+		"email_verified": true,
+		"name":           "Reader",
+		"groups":         []string{"library-staff"},
+		"nonce":          q.Get("nonce"),
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+	}
+	if edit != nil {
+		edit(claims)
+	}
+
+	code := "code-" + q.Get("state")
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), claims: claims}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockOIDC) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return signed
+}
+
+// startLogin begins a sign-in the way the login handler does
+func startLogin(t *testing.T, p *OIDCProvider) (authURL, nonce, verifier string) {
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce = "nonce-1"
+	authURL, err = p.AuthCodeURL("state-1", nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authURL, nonce, verifier
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+
+	authURL, nonce, verifier := startLogin(t, p)
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") {
+		t.Fatalf("auth URL %s doesn't use the discovered endpoint", authURL)
+	}
+
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	sum := sha256.Sum256([]byte(verifier))
+	want := map[string]string{
+		"response_type":  "code",
+		"client_id":      mockClientID,
+		"redirect_uri":   p.RedirectURL,
+		"state":          "state-1",
+		"nonce":          nonce,
+		"code_challenge": base64.RawURLEncoding.EncodeToString(sum[:]),
+	}
+	for name, value := range want {
+		if got := q.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+
+	authURL, nonce, verifier := startLogin(t, p)
+	code := m.authorize(authURL, nil)
+
+	raw, err := p.Exchange(code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := p.VerifyIDToken(raw, nonce, "groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.Subject != "user-1" || id.Email != "reader@example.com" || !id.EmailVerified || id.Name != "Reader" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	if len(id.Groups) != 1 || id.Groups[0] != "library-staff" {
+		t.Errorf("groups = %v, want [library-staff]", id.Groups)
+	}
+}
+
+func TestOIDCExchangeRejectsPKCEMismatch(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+
+	authURL, _, _ := startLogin(t, p)
+	code := m.authorize(authURL, nil)
+
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(code, otherVerifier); err == nil {
+		t.Error("exchange succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestOIDCExchangeRejectsReusedCode(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+
+	authURL, _, verifier := startLogin(t, p)
+	code := m.authorize(authURL, nil)
+
+	if _, err := p.Exchange(code, verifier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(code, verifier); err == nil {
+		t.Error("exchange succeeded with a code that was already redeemed")
+	}
+}
+
+func TestOIDCVerifyIDTokenRejects(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		nonce string // nonce the callback expects; the login's when empty
+		edit  func(jwt.MapClaims)
+		raw   func(m *mockOIDC, claims jwt.MapClaims) string
+	}{
+		{name: "nonce mismatch", nonce: "another-nonce"},
+		{name: "missing nonce", edit: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "wrong audience", edit: func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{name: "wrong issuer", edit: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "other authorized party", edit: func(c jwt.MapClaims) { c["azp"] = "another-client" }},
+		{name: "expired", edit: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "issued in the future", edit: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "no subject", edit: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "signed by another key", raw: func(m *mockOIDC, claims jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			token.Header["kid"] = m.kid
+			signed, _ := token.SignedString(otherKey)
+			return signed
+		}},
+		{name: "unsigned", raw: func(m *mockOIDC, claims jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+			token.Header["kid"] = m.kid
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}},
+	}
+
+	m := newMockOIDC(t)
+	p := m.provider()
+
+	for _, tt := range tests {
+		authURL, nonce, verifier := startLogin(t, p)
+		code := m.authorize(authURL, tt.edit)
+
+		raw, err := p.Exchange(code, verifier)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.raw != nil {
+			parsed, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			raw = tt.raw(m, parsed.Claims.(jwt.MapClaims))
+		}
+		if tt.nonce != "" {
+			nonce = tt.nonce
+		}
+
+		if id, err := p.VerifyIDToken(raw, nonce, "groups"); err == nil {
+			t.Errorf("%s: accepted ID token for %+v", tt.name, id)
+		}
+	}
+}
+
+func TestOIDCDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+	p.Issuer = m.server.URL + "/other"
+
+	if _, err := p.AuthCodeURL("state", "nonce", "challenge"); err == nil {
+		t.Error("discovery accepted a document for another issuer")
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// Claims are the claims of an access token: the registered claims plus the
+// user and session it was issued to
+type Claims struct {
+	Userid    string `json:"userid"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// issuer is the "iss" of the tokens this server signs, set by JWT_ISSUER
+func issuer() string {
+	if iss := viper.GetString("JWT_ISSUER"); iss != "" {
+		return iss
+	}
+	return "rethink"
+}
+
+// audience is the "aud" tokens must be issued for, set by JWT_AUDIENCE
+func audience() string {
+	if aud := viper.GetString("JWT_AUDIENCE"); aud != "" {
+		return aud
+	}
+	return "rethink-api"
+}
+
+// clockSkew is the leeway allowed on exp, nbf and iat, set in seconds by
+// JWT_CLOCK_SKEW
+func clockSkew() time.Duration {
+	if viper.IsSet("JWT_CLOCK_SKEW") {
+		return time.Duration(viper.GetInt("JWT_CLOCK_SKEW")) * time.Second
+	}
+	return 30 * time.Second
+}
+
+func secret() ([]byte, error) {
+	key := viper.GetString("JWT_SECRET")
+	if key == "" {
+		return nil, errors.New("JWT_SECRET not found in config file")
+	}
+	return []byte(key), nil
+}
+
+// Secret is the JWT_SECRET that signs HS256 tokens, loaded with the config.
+// Handlers sign their single-purpose links with it.
+func Secret() ([]byte, error) {
+	return secret()
+}
+
+// NewClaims fills in the registered claims for a token valid for ttl
+func NewClaims(userid, email, name, role, sessionID string, ttl time.Duration) *Claims {
+	now := time.Now()
+	return &Claims{
+		Userid:    userid,
+		Email:     email,
+		Name:      name,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   userid,
+			Issuer:    issuer(),
+			Audience:  jwt.ClaimStrings{audience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// SignToken signs the claims with the current signing key, naming it in the
+// kid header
+func SignToken(claims *Claims) (string, error) {
+	method, key, kid, err := signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(key)
+}
+
+// Valid checks the registered claims, allowing for clock skew. Every claim
+// is required, so tokens signed before these claims existed are rejected.
+func (c *Claims) Valid() error {
+	return c.validate(time.Now(), false)
+}
+
+func (c *Claims) validate(now time.Time, allowExpired bool) error {
+	skew := clockSkew()
+
+	if !allowExpired && !c.VerifyExpiresAt(now.Add(-skew), true) {
+		return jwt.ErrTokenExpired
+	}
+	if !c.VerifyNotBefore(now.Add(skew), true) {
+		return jwt.ErrTokenNotValidYet
+	}
+	if !c.VerifyIssuedAt(now.Add(skew), true) {
+		return jwt.ErrTokenUsedBeforeIssued
+	}
+	if !c.VerifyIssuer(issuer(), true) {
+		return jwt.ErrTokenInvalidIssuer
+	}
+	if !c.VerifyAudience(audience(), true) {
+		return jwt.ErrTokenInvalidAudience
+	}
+	if c.ID == "" {
+		return jwt.ErrTokenInvalidId
+	}
+	if c.Userid == "" {
+		return errors.New("userid missing in token")
+	}
+
+	return nil
+}
+
+// ParseToken verifies a token's signature and claims. An expired token
+// returns an error matching jwt.ErrTokenExpired.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, verificationKey); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ParseExpiredToken is ParseToken without the expiry check, for ending the
+// session of a token that has already expired
+func ParseExpiredToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	if _, err := parser.ParseWithClaims(tokenString, claims, verificationKey); err != nil {
+		return nil, err
+	}
+	if err := claims.validate(time.Now(), true); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// TOTP codes follow RFC 6238 with the defaults authenticator apps expect:
+// HMAC-SHA1, 6 digits and a 30 second period
+const (
+	totpDigits = 6
+	totpPeriod = 30
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random secret in the base32 form authenticator
+// apps take
+func NewTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(buf), nil
+}
+
+// totpIssuer is the name shown in authenticator apps, set by TOTP_ISSUER
+func totpIssuer() string {
+	if name := viper.GetString("TOTP_ISSUER"); name != "" {
+		return name
+	}
+	return "Rethink Library"
+}
+
+// TOTPURI is the otpauth:// provisioning URI to show as a QR code
+func TOTPURI(account, secret string) string {
+	issuer := totpIssuer()
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpCode computes the code for a time step
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// CheckTOTP validates a code against the secret, allowing one step of clock
+// drift either way. It returns the matching time step so callers can refuse
+// a code that was already used; codes at or before lastStep never match.
+func CheckTOTP(secret, code string, lastStep int64) (int64, bool) {
+	return checkTOTPAt(secret, code, lastStep, time.Now())
+}
+
+// checkTOTPAt is CheckTOTP at the given time
+func checkTOTPAt(secret, code string, lastStep int64, at time.Time) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	now := at.Unix() / totpPeriod
+	for step := now - 1; step <= now+1; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// NewRecoveryCodes returns a fresh set of one-time recovery codes
+func NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(buf))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode is how recovery codes are stored. Formatting the user
+// may add or drop is ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// totpKey is the AES-256 key TOTP secrets are encrypted with: TOTP_ENCRYPTION_KEY
+// as 32 base64 encoded bytes, or else one derived from JWT_SECRET
+func totpKey() ([]byte, error) {
+	if configured := viper.GetString("TOTP_ENCRYPTION_KEY"); configured != "" {
+		key, err := base64.StdEncoding.DecodeString(configured)
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("TOTP_ENCRYPTION_KEY must be 32 base64 encoded bytes")
+		}
+		return key, nil
+	}
+
+	jwtSecret, err := secret()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append([]byte("totp-secret:"), jwtSecret...))
+	return sum[:], nil
+}
+
+func totpCipher() (cipher.AEAD, error) {
+	key, err := totpKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptTOTPSecret seals a secret for storage on the user record
+func EncryptTOTPSecret(plain string) (string, error) {
+	gcm, err := totpCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptTOTPSecret opens a secret sealed by EncryptTOTPSecret
+func DecryptTOTPSecret(sealed string) (string, error) {
+	gcm, err := totpCipher()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid TOTP secret")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("invalid TOTP secret")
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA1 seed of RFC 6238 Appendix B
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// Appendix B lists 8 digit codes; these are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Key, tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	secret := base32NoPadding.EncodeToString(rfc6238Key)
+	at := time.Unix(1234567890, 0)
+	now := at.Unix() / totpPeriod
+
+	spaced := func(code string) string { return code[:3] + " " + code[3:] }
+	wrong := func(string) string { return "000000" }
+	short := func(code string) string { return code[:5] }
+
+	tests := []struct {
+		name     string
+		step     int64 // step the code is generated for
+		edit     func(string) string
+		lastStep int64
+		ok       bool
+	}{
+		{"current step", now, nil, 0, true},
+		{"one step behind", now - 1, nil, 0, true},
+		{"one step ahead", now + 1, nil, 0, true},
+		{"two steps behind", now - 2, nil, 0, false},
+		{"two steps ahead", now + 2, nil, 0, false},
+		{"replayed step", now, nil, now, false},
+		{"earlier step after a later one was used", now - 1, nil, now, false},
+		{"later step after an earlier one was used", now + 1, nil, now, true},
+		{"spaces ignored", now, spaced, 0, true},
+		{"wrong code", now, wrong, 0, false},
+		{"too short", now, short, 0, false},
+	}
+
+	for _, tt := range tests {
+		code := totpCode(rfc6238Key, tt.step)
+		if tt.edit != nil {
+			code = tt.edit(code)
+		}
+
+		step, ok := checkTOTPAt(secret, code, tt.lastStep, at)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && step != tt.step {
+			t.Errorf("%s: step = %d, want %d", tt.name, step, tt.step)
+		}
+	}
+}
+
+func TestCheckTOTPBadSecret(t *testing.T) {
+	if _, ok := checkTOTPAt("not base32!", "123456", 0, time.Now()); ok {
+		t.Error("accepted a code for an invalid secret")
+	}
+}
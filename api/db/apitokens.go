@@ -0,0 +1,164 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"rethink/api/models"
+	"sort"
+	"time"
+)
+
+// APITokenPrefix starts every API token, telling them apart from JWTs
+const APITokenPrefix = "rtk_"
+
+// API tokens are stored as JSON under "apitoken:<hash of the token>", and
+// each user has a set "apitokens:<userid>" of their token hashes. Tokens
+// expire on their own; the set expires with the longest-lived of them.
+func apiTokenHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiTokenKey(hash string) string {
+	return "apitoken:" + hash
+}
+
+func userAPITokensKey(userID string) string {
+	return "apitokens:" + userID
+}
+
+func saveAPIToken(hash string, token *models.APIToken) error {
+	ttl := time.Until(token.ExpiresAt)
+	if ttl <= 0 {
+		return errors.New("token expired")
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	return store.Set(apiTokenKey(hash), data, ttl)
+}
+
+func getAPIToken(hash string) (*models.APIToken, error) {
+	data, err := store.Get(apiTokenKey(hash))
+	if err != nil {
+		return nil, errors.New("token not found")
+	}
+
+	var token models.APIToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateAPIToken stores a new token under the hash of its secret
+func CreateAPIToken(secret string, token *models.APIToken) error {
+	hash := apiTokenHash(secret)
+	if err := saveAPIToken(hash, token); err != nil {
+		return err
+	}
+
+	key := userAPITokensKey(token.Userid)
+	if err := store.SAdd(key, hash); err != nil {
+		return err
+	}
+	ttl := time.Until(token.ExpiresAt)
+	if current, err := store.TTL(key); err == nil && current > ttl {
+		ttl = current
+	}
+	return store.Expire(key, ttl)
+}
+
+// GetAPIToken looks up the token a secret belongs to
+func GetAPIToken(secret string) (*models.APIToken, error) {
+	return getAPIToken(apiTokenHash(secret))
+}
+
+// TouchAPIToken records the use of a token, at most once per touchInterval
+func TouchAPIToken(secret string, token *models.APIToken) error {
+	if time.Since(token.LastUsed) < touchInterval {
+		return nil
+	}
+	token.LastUsed = time.Now()
+	return saveAPIToken(apiTokenHash(secret), token)
+}
+
+// userAPITokens returns the user's live tokens by hash. Expired tokens are
+// dropped from the user's set along the way.
+func userAPITokens(userID string) (map[string]*models.APIToken, error) {
+	hashes, err := store.SMembers(userAPITokensKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := map[string]*models.APIToken{}
+	for _, hash := range hashes {
+		token, err := getAPIToken(hash)
+		if err != nil {
+			store.SRem(userAPITokensKey(userID), hash)
+			continue
+		}
+		tokens[hash] = token
+	}
+	return tokens, nil
+}
+
+// ListAPITokens returns the user's tokens, newest first
+func ListAPITokens(userID string) ([]models.APIToken, error) {
+	byHash, err := userAPITokens(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []models.APIToken{}
+	for _, token := range byHash {
+		tokens = append(tokens, *token)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+// DeleteAPIToken revokes one of the user's tokens by ID
+func DeleteAPIToken(userID, id string) error {
+	tokens, err := userAPITokens(userID)
+	if err != nil {
+		return err
+	}
+
+	for hash, token := range tokens {
+		if token.ID != id {
+			continue
+		}
+		if _, err := store.Delete(apiTokenKey(hash)); err != nil {
+			return err
+		}
+		return store.SRem(userAPITokensKey(userID), hash)
+	}
+
+	return errors.New("token not found")
+}
+
+// DeleteUserAPITokens revokes every token of the user
+func DeleteUserAPITokens(userID string) error {
+	hashes, err := store.SMembers(userAPITokensKey(userID))
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if _, err := store.Delete(apiTokenKey(hash)); err != nil {
+			return err
+		}
+	}
+	_, err = store.Delete(userAPITokensKey(userID))
+	return err
+}
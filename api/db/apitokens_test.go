@@ -0,0 +1,102 @@
+package db
+
+import (
+	"rethink/api/models"
+	"testing"
+	"time"
+)
+
+func newTestAPIToken(id, userID string, created time.Time, ttl time.Duration) *models.APIToken {
+	return &models.APIToken{
+		ID:        id,
+		Userid:    userID,
+		Scopes:    []string{"book_read"},
+		CreatedAt: created,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	s := useMemoryStore(t)
+
+	now := time.Now()
+	if err := CreateAPIToken(APITokenPrefix+"long", newTestAPIToken("long", "alice", now.Add(-time.Hour), 90*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateAPIToken(APITokenPrefix+"short", newTestAPIToken("short", "alice", now, 24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	CreateAPIToken(APITokenPrefix+"bob", newTestAPIToken("bob", "bob", now, 24*time.Hour))
+
+	token, err := GetAPIToken(APITokenPrefix + "long")
+	if err != nil || token.ID != "long" || token.Userid != "alice" {
+		t.Fatalf("GetAPIToken = %+v, %v", token, err)
+	}
+	if _, err := GetAPIToken(APITokenPrefix + "unknown"); err == nil {
+		t.Error("GetAPIToken found an unknown token")
+	}
+
+	// Only hashes are stored
+	if _, err := s.Get(apiTokenKey(APITokenPrefix + "long")); err == nil {
+		t.Error("token stored under its secret")
+	}
+
+	// The user's set lives as long as their longest-lived token
+	ttl, _ := s.TTL(userAPITokensKey("alice"))
+	if ttl < 89*24*time.Hour || ttl > 90*24*time.Hour {
+		t.Errorf("token set TTL = %v, want about 90 days", ttl)
+	}
+
+	tokens, err := ListAPITokens("alice")
+	if err != nil || len(tokens) != 2 || tokens[0].ID != "short" || tokens[1].ID != "long" {
+		t.Errorf("ListAPITokens = %+v, %v, want newest first", tokens, err)
+	}
+
+	if err := DeleteAPIToken("bob", "long"); err == nil {
+		t.Error("a user revoked another user's token")
+	}
+	if err := DeleteAPIToken("alice", "long"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetAPIToken(APITokenPrefix + "long"); err == nil {
+		t.Error("revoked token still found")
+	}
+
+	if err := DeleteUserAPITokens("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetAPIToken(APITokenPrefix + "short"); err == nil {
+		t.Error("token found after revoking all of the user's tokens")
+	}
+	if tokens, _ := ListAPITokens("alice"); len(tokens) != 0 {
+		t.Errorf("ListAPITokens after revoking all = %+v", tokens)
+	}
+	if _, err := GetAPIToken(APITokenPrefix + "bob"); err != nil {
+		t.Error("revoking one user's tokens revoked another user's")
+	}
+}
+
+func TestTouchAPIToken(t *testing.T) {
+	useMemoryStore(t)
+
+	secret := APITokenPrefix + "secret"
+	CreateAPIToken(secret, newTestAPIToken("id", "alice", time.Now(), time.Hour))
+
+	token, _ := GetAPIToken(secret)
+	if err := TouchAPIToken(secret, token); err != nil {
+		t.Fatal(err)
+	}
+
+	token, _ = GetAPIToken(secret)
+	if time.Since(token.LastUsed) > time.Minute {
+		t.Errorf("LastUsed = %v, want now", token.LastUsed)
+	}
+}
+
+func TestCreateAPITokenRefusesExpired(t *testing.T) {
+	useMemoryStore(t)
+
+	if err := CreateAPIToken(APITokenPrefix+"old", newTestAPIToken("old", "alice", time.Now(), -time.Hour)); err == nil {
+		t.Error("stored an expired token")
+	}
+}
@@ -67,7 +67,3 @@ func InitRedis() {
 	})
 	return
 }
-
-func GetRedisClient() *redis.Client {
-	return redisClient
-}
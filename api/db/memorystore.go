@@ -0,0 +1,188 @@
+package db
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in memory. They are lost on restart and not
+// shared between instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	value   []byte
+	members map[string]bool
+	expires time.Time // zero never expires
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// NewMemoryStore creates an empty MemoryStore that purges expired keys every
+// sweep
+func NewMemoryStore(sweep time.Duration) *MemoryStore {
+	s := &MemoryStore{entries: map[string]*memoryEntry{}}
+	go func() {
+		for range time.Tick(sweep) {
+			s.purge()
+		}
+	}()
+	return s
+}
+
+func (s *MemoryStore) purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// entry returns the live entry at key. The caller holds s.mu.
+func (s *MemoryStore) entry(key string) (*memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entry(key)
+	if !ok || entry.value == nil {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &memoryEntry{value: append([]byte{}, value...), expires: expiry(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entry(key); ok {
+		return false, nil
+	}
+	s.entries[key] = &memoryEntry{value: append([]byte{}, value...), expires: expiry(ttl)}
+	return true, nil
+}
+
+func (s *MemoryStore) Delete(keys ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := s.entry(key); ok {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) TTL(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entry(key)
+	if !ok || entry.expires.IsZero() {
+		return 0, nil
+	}
+	return time.Until(entry.expires), nil
+}
+
+func (s *MemoryStore) Expire(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entry(key); ok {
+		entry.expires = expiry(ttl)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	if entry, ok := s.entry(key); ok {
+		var err error
+		if n, err = strconv.ParseInt(string(entry.value), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	s.entries[key] = &memoryEntry{value: []byte(strconv.FormatInt(n, 10)), expires: expiry(ttl)}
+	return n, nil
+}
+
+func (s *MemoryStore) SAdd(key, member string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entry(key)
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	if entry.members == nil {
+		entry.members = map[string]bool{}
+	}
+	entry.members[member] = true
+	return nil
+}
+
+func (s *MemoryStore) SRem(key, member string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entry(key); ok {
+		delete(entry.members, member)
+	}
+	return nil
+}
+
+func (s *MemoryStore) SMembers(key string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := []string{}
+	if entry, ok := s.entry(key); ok {
+		for member := range entry.members {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// PasswordPolicy describes the rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// BreachedPasswords holds SHA-1 hashes of known breached passwords, bucketed
+// by their first five hex characters like the k-anonymity range API of
+// Have I Been Pwned
+type BreachedPasswords struct {
+	prefixes map[string]map[string]bool
+}
+
+var policy = PasswordPolicy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true}
+var breached *BreachedPasswords
+
+// InitPasswordPolicy reads the PASSWORD_* settings from config.json and loads
+// the breached password list from BREACHED_PASSWORDS_FILE when set
+func InitPasswordPolicy() {
+	if viper.IsSet("PASSWORD_MIN_LENGTH") {
+		policy.MinLength = viper.GetInt("PASSWORD_MIN_LENGTH")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_UPPER") {
+		policy.RequireUpper = viper.GetBool("PASSWORD_REQUIRE_UPPER")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_LOWER") {
+		policy.RequireLower = viper.GetBool("PASSWORD_REQUIRE_LOWER")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_DIGIT") {
+		policy.RequireDigit = viper.GetBool("PASSWORD_REQUIRE_DIGIT")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_SYMBOL") {
+		policy.RequireSymbol = viper.GetBool("PASSWORD_REQUIRE_SYMBOL")
+	}
+
+	path := viper.GetString("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		return
+	}
+
+	list, err := LoadBreachedPasswords(path)
+	if err != nil {
+		log.Fatal("Failed to load breached passwords:", err)
+	}
+	breached = list
+}
+
+// LoadBreachedPasswords reads a file of SHA-1 password hashes, one per line.
+// Lines may carry a ":count" suffix as in the Have I Been Pwned downloads.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedPasswords{prefixes: map[string]map[string]bool{}}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) != 40 {
+			continue
+		}
+		hash = strings.ToUpper(hash)
+
+		prefix, suffix := hash[:5], hash[5:]
+		if list.prefixes[prefix] == nil {
+			list.prefixes[prefix] = map[string]bool{}
+		}
+		list.prefixes[prefix][suffix] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Contains reports whether the password appears in the list
+func (b *BreachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return b.prefixes[hash[:5]][hash[5:]]
+}
+
+// ValidatePassword checks a new password against the policy and the breached
+// password list and returns every rule it breaks
+func ValidatePassword(password, email, name string) []string {
+	var problems []string
+
+	if len([]rune(password)) < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("Password must be at least %d characters long", policy.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, ch := range password {
+		switch {
+		case unicode.IsUpper(ch):
+			upper = true
+		case unicode.IsLower(ch):
+			lower = true
+		case unicode.IsDigit(ch):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	if policy.RequireUpper && !upper {
+		problems = append(problems, "Password must contain an uppercase letter")
+	}
+	if policy.RequireLower && !lower {
+		problems = append(problems, "Password must contain a lowercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		problems = append(problems, "Password must contain a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		problems = append(problems, "Password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if (email != "" && (lowered == strings.ToLower(email) || lowered == localPart)) ||
+		(name != "" && lowered == strings.ToLower(name)) {
+		problems = append(problems, "Password must not be your email or name")
+	}
+
+	if breached != nil && breached.Contains(password) {
+		problems = append(problems, "This password has appeared in a data breach, please choose another")
+	}
+
+	return problems
+}
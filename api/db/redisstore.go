@@ -0,0 +1,72 @@
+package db
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisStore keeps sessions in Redis, which expires keys itself
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a RedisStore on the client
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(key string) ([]byte, error) {
+	data, err := s.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *RedisStore) Set(key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(key, value, ttl).Err()
+}
+
+func (s *RedisStore) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(key, value, ttl).Result()
+}
+
+func (s *RedisStore) Delete(keys ...string) (int, error) {
+	n, err := s.client.Del(keys...).Result()
+	return int(n), err
+}
+
+func (s *RedisStore) TTL(key string) (time.Duration, error) {
+	ttl, err := s.client.TTL(key).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Expire(key string, ttl time.Duration) error {
+	return s.client.Expire(key, ttl).Err()
+}
+
+func (s *RedisStore) Incr(key string, ttl time.Duration) (int64, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(key)
+	pipe.Expire(key, ttl)
+	if _, err := pipe.Exec(); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (s *RedisStore) SAdd(key, member string) error {
+	return s.client.SAdd(key, member).Err()
+}
+
+func (s *RedisStore) SRem(key, member string) error {
+	return s.client.SRem(key, member).Err()
+}
+
+func (s *RedisStore) SMembers(key string) ([]string, error) {
+	return s.client.SMembers(key).Result()
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	r "github.com/rethinkdb/rethinkdb-go"
+)
+
+// RethinkStore keeps sessions in the "sessions" table, one document per key
+// with its value or members and an "expires_at" time. Expired documents are
+// ignored on read and deleted by a periodic sweep.
+type RethinkStore struct {
+	session *r.Session
+}
+
+type rethinkEntry struct {
+	Key       string     `rethinkdb:"id"`
+	Value     string     `rethinkdb:"value"`
+	Members   []string   `rethinkdb:"members"`
+	ExpiresAt *time.Time `rethinkdb:"expires_at"`
+}
+
+func (e *rethinkEntry) live() bool {
+	return e.ExpiresAt == nil || time.Now().Before(*e.ExpiresAt)
+}
+
+// NewRethinkStore creates a RethinkStore that sweeps expired keys every sweep
+func NewRethinkStore(session *r.Session, sweep time.Duration) *RethinkStore {
+	s := &RethinkStore{session: session}
+	go func() {
+		for range time.Tick(sweep) {
+			if err := s.purge(); err != nil {
+				log.Println("Error sweeping expired sessions:", err)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *RethinkStore) table() r.Term {
+	return r.Table("sessions")
+}
+
+func (s *RethinkStore) purge() error {
+	_, err := s.table().Filter(r.Row.Field("expires_at").Lt(r.Now())).Delete().RunWrite(s.session)
+	return err
+}
+
+// liveTerm is true for a document that exists and hasn't expired
+func liveTerm(row r.Term) r.Term {
+	return r.Branch(
+		row.Eq(nil), false,
+		row.HasFields("expires_at").Not(), true,
+		row.Field("expires_at").Gt(r.Now()),
+	)
+}
+
+// entryDoc is a new document for a key
+func entryDoc(key string, fields map[string]interface{}, ttl time.Duration) map[string]interface{} {
+	doc := map[string]interface{}{"id": key}
+	for name, value := range fields {
+		doc[name] = value
+	}
+	if ttl > 0 {
+		doc["expires_at"] = time.Now().Add(ttl)
+	}
+	return doc
+}
+
+func (s *RethinkStore) entry(key string) (*rethinkEntry, error) {
+	cursor, err := s.table().Get(key).Run(s.session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, ErrNotFound
+	}
+
+	var entry rethinkEntry
+	if err := cursor.One(&entry); err != nil {
+		return nil, err
+	}
+	if !entry.live() {
+		return nil, ErrNotFound
+	}
+	return &entry, nil
+}
+
+func (s *RethinkStore) Get(key string) ([]byte, error) {
+	entry, err := s.entry(key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(entry.Value), nil
+}
+
+func (s *RethinkStore) Set(key string, value []byte, ttl time.Duration) error {
+	doc := entryDoc(key, map[string]interface{}{"value": string(value)}, ttl)
+	_, err := s.table().Insert(doc, r.InsertOpts{Conflict: "replace"}).RunWrite(s.session)
+	return err
+}
+
+func (s *RethinkStore) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	doc := entryDoc(key, map[string]interface{}{"value": string(value)}, ttl)
+	res, err := s.table().Get(key).Replace(func(row r.Term) interface{} {
+		return r.Branch(liveTerm(row), row, doc)
+	}).RunWrite(s.session)
+	if err != nil {
+		return false, err
+	}
+	return res.Inserted+res.Replaced > 0, nil
+}
+
+func (s *RethinkStore) Delete(keys ...string) (int, error) {
+	ids := make([]interface{}, len(keys))
+	for i, key := range keys {
+		ids[i] = key
+	}
+	res, err := s.table().GetAll(ids...).Filter(liveTerm).Delete().RunWrite(s.session)
+	if err != nil {
+		return 0, err
+	}
+	return res.Deleted, nil
+}
+
+func (s *RethinkStore) TTL(key string) (time.Duration, error) {
+	entry, err := s.entry(key)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil || entry.ExpiresAt == nil {
+		return 0, err
+	}
+	return time.Until(*entry.ExpiresAt), nil
+}
+
+func (s *RethinkStore) Expire(key string, ttl time.Duration) error {
+	_, err := s.table().Get(key).Replace(func(row r.Term) interface{} {
+		return r.Branch(liveTerm(row), row.Without("expires_at").Merge(entryDoc(key, nil, ttl)), row)
+	}).RunWrite(s.session)
+	return err
+}
+
+func (s *RethinkStore) Incr(key string, ttl time.Duration) (int64, error) {
+	res, err := s.table().Get(key).Replace(func(row r.Term) interface{} {
+		return r.Branch(liveTerm(row),
+			entryDoc(key, map[string]interface{}{
+				"value": row.Field("value").CoerceTo("number").Add(1).CoerceTo("string"),
+			}, ttl),
+			entryDoc(key, map[string]interface{}{"value": "1"}, ttl),
+		)
+	}, r.ReplaceOpts{ReturnChanges: true}).RunWrite(s.session)
+	if err != nil {
+		return 0, err
+	}
+	if len(res.Changes) == 0 {
+		return 0, errors.New("counter was not updated")
+	}
+
+	doc, _ := res.Changes[0].NewValue.(map[string]interface{})
+	value, _ := doc["value"].(string)
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (s *RethinkStore) SAdd(key, member string) error {
+	_, err := s.table().Get(key).Replace(func(row r.Term) interface{} {
+		return r.Branch(liveTerm(row),
+			row.Merge(map[string]interface{}{"members": row.Field("members").Default([]string{}).SetInsert(member)}),
+			entryDoc(key, map[string]interface{}{"members": []string{member}}, 0),
+		)
+	}).RunWrite(s.session)
+	return err
+}
+
+func (s *RethinkStore) SRem(key, member string) error {
+	_, err := s.table().Get(key).
+		Update(map[string]interface{}{"members": r.Row.Field("members").Default([]string{}).SetDifference([]string{member})}).
+		RunWrite(s.session)
+	return err
+}
+
+func (s *RethinkStore) SMembers(key string) ([]string, error) {
+	entry, err := s.entry(key)
+	if err == ErrNotFound {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry.Members, nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"rethink/api/models"
+	"sort"
+	"time"
+)
+
+// SessionTTL is how long a session lasts after login or its last refresh
+const SessionTTL = 30 * 24 * time.Hour
+
+// touchInterval limits how often a session's last-seen time is written
+const touchInterval = time.Minute
+
+// Sessions are stored as JSON under "session:<id>", and each user has a set
+// "sessions:<userid>" of their session IDs.
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID string) string {
+	return "sessions:" + userID
+}
+
+func saveSession(session *models.Session) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return errors.New("session expired")
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return store.Set(sessionKey(session.ID), data, ttl)
+}
+
+// CreateSession stores a new session and adds it to the user's sessions
+func CreateSession(session *models.Session) error {
+	if err := saveSession(session); err != nil {
+		return err
+	}
+
+	key := userSessionsKey(session.Userid)
+	if err := store.SAdd(key, session.ID); err != nil {
+		return err
+	}
+	return store.Expire(key, SessionTTL)
+}
+
+// ExtendSession pushes a session's expiry SessionTTL into the future
+func ExtendSession(session *models.Session) error {
+	session.ExpiresAt = time.Now().Add(SessionTTL)
+	session.LastSeen = time.Now()
+	if err := saveSession(session); err != nil {
+		return err
+	}
+	return store.Expire(userSessionsKey(session.Userid), SessionTTL)
+}
+
+// GetSession fetches a session by ID
+func GetSession(id string) (*models.Session, error) {
+	data, err := store.Get(sessionKey(id))
+	if err != nil {
+		return nil, errors.New("session not found")
+	}
+
+	var session models.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TouchSession records activity on a session, at most once per touchInterval
+func TouchSession(session *models.Session) error {
+	if time.Since(session.LastSeen) < touchInterval {
+		return nil
+	}
+	session.LastSeen = time.Now()
+	return saveSession(session)
+}
+
+// ListSessions returns the user's live sessions, most recently used first.
+// Expired sessions are dropped from the user's set along the way.
+func ListSessions(userID string) ([]models.Session, error) {
+	ids, err := store.SMembers(userSessionsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []models.Session{}
+	for _, id := range ids {
+		session, err := GetSession(id)
+		if err != nil {
+			store.SRem(userSessionsKey(userID), id)
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+// DeleteSession ends one of the user's sessions
+func DeleteSession(userID, id string) error {
+	session, err := GetSession(id)
+	if err != nil || session.Userid != userID {
+		return errors.New("session not found")
+	}
+
+	if _, err := store.Delete(sessionKey(id)); err != nil {
+		return err
+	}
+	return store.SRem(userSessionsKey(userID), id)
+}
+
+// DeleteUserSessions ends every session of the user except exceptID, which
+// may be empty to end them all
+func DeleteUserSessions(userID, exceptID string) error {
+	ids, err := store.SMembers(userSessionsKey(userID))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if id == exceptID {
+			continue
+		}
+		if _, err := store.Delete(sessionKey(id)); err != nil {
+			return err
+		}
+		if err := store.SRem(userSessionsKey(userID), id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Refresh tokens are stored by hash under "refresh:<hash>" with the session
+// they belong to. Spending one sets "refresh:spent:<hash>", so a second use
+// of the same token can be told apart from an unknown token.
+type refreshToken struct {
+	SessionID string `json:"sid"`
+	Userid    string `json:"userid"`
+}
+
+// StoreRefreshToken records the hash of a refresh token for a session. It
+// stays valid until the session expires or the token is spent.
+func StoreRefreshToken(hash string, session *models.Session) error {
+	data, err := json.Marshal(refreshToken{SessionID: session.ID, Userid: session.Userid})
+	if err != nil {
+		return err
+	}
+	return store.Set("refresh:"+hash, data, time.Until(session.ExpiresAt))
+}
+
+// SpendRefreshToken marks a refresh token as used and returns its session and
+// user. reused is true when the token had already been spent.
+func SpendRefreshToken(hash string) (sessionID, userID string, reused bool, err error) {
+	key := "refresh:" + hash
+	data, err := store.Get(key)
+	if err != nil {
+		return "", "", false, errors.New("invalid refresh token")
+	}
+
+	var token refreshToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", "", false, err
+	}
+
+	ttl, err := store.TTL(key)
+	if err != nil || ttl <= 0 {
+		ttl = SessionTTL
+	}
+
+	first, err := store.SetNX("refresh:spent:"+hash, []byte("1"), ttl)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	return token.SessionID, token.Userid, !first, nil
+}
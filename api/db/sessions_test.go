@@ -0,0 +1,125 @@
+package db
+
+import (
+	"rethink/api/models"
+	"testing"
+	"time"
+)
+
+func newTestSession(id, userID string, lastSeen time.Time) *models.Session {
+	return &models.Session{
+		ID:        id,
+		Userid:    userID,
+		CreatedAt: lastSeen,
+		LastSeen:  lastSeen,
+		ExpiresAt: time.Now().Add(SessionTTL),
+	}
+}
+
+func sessionIDs(sessions []models.Session) []string {
+	ids := []string{}
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func TestSessions(t *testing.T) {
+	useMemoryStore(t)
+
+	now := time.Now()
+	for _, session := range []*models.Session{
+		newTestSession("laptop", "alice", now.Add(-time.Hour)),
+		newTestSession("phone", "alice", now),
+		newTestSession("tablet", "alice", now.Add(-2*time.Hour)),
+		newTestSession("desktop", "bob", now),
+	} {
+		if err := CreateSession(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session, err := GetSession("laptop")
+	if err != nil || session.Userid != "alice" {
+		t.Fatalf("GetSession = %+v, %v", session, err)
+	}
+	if _, err := GetSession("missing"); err == nil {
+		t.Error("GetSession found a missing session")
+	}
+
+	sessions, err := ListSessions("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := sessionIDs(sessions); len(ids) != 3 || ids[0] != "phone" || ids[1] != "laptop" || ids[2] != "tablet" {
+		t.Errorf("ListSessions = %v, want most recently used first", ids)
+	}
+
+	if err := DeleteSession("bob", "laptop"); err == nil {
+		t.Error("a user deleted another user's session")
+	}
+	if err := DeleteSession("alice", "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSession("laptop"); err == nil {
+		t.Error("deleted session still found")
+	}
+
+	if err := DeleteUserSessions("alice", "phone"); err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ = ListSessions("alice")
+	if ids := sessionIDs(sessions); len(ids) != 1 || ids[0] != "phone" {
+		t.Errorf("after logging out other sessions: %v, want [phone]", ids)
+	}
+
+	if err := DeleteUserSessions("alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := ListSessions("alice"); len(sessions) != 0 {
+		t.Errorf("after logging out everywhere: %v, want none", sessionIDs(sessions))
+	}
+	if _, err := GetSession("desktop"); err != nil {
+		t.Error("logging out one user ended another user's session")
+	}
+}
+
+func TestListSessionsDropsExpired(t *testing.T) {
+	s := useMemoryStore(t)
+
+	CreateSession(newTestSession("old", "alice", time.Now()))
+	CreateSession(newTestSession("new", "alice", time.Now()))
+	s.Delete(sessionKey("old"))
+
+	sessions, err := ListSessions("alice")
+	if ids := sessionIDs(sessions); err != nil || len(ids) != 1 || ids[0] != "new" {
+		t.Errorf("ListSessions = %v, %v, want [new]", ids, err)
+	}
+	if members, _ := s.SMembers(userSessionsKey("alice")); len(members) != 1 {
+		t.Errorf("expired session left in the user's set: %v", members)
+	}
+}
+
+func TestSpendRefreshToken(t *testing.T) {
+	useMemoryStore(t)
+
+	session := newTestSession("laptop", "alice", time.Now())
+	if err := StoreRefreshToken("hash", session); err != nil {
+		t.Fatal(err)
+	}
+
+	sessionID, userID, reused, err := SpendRefreshToken("hash")
+	if err != nil || sessionID != "laptop" || userID != "alice" || reused {
+		t.Errorf("first spend = %q, %q, reused %v, %v", sessionID, userID, reused, err)
+	}
+
+	// A second use is reported so the session can be ended
+	sessionID, userID, reused, err = SpendRefreshToken("hash")
+	if err != nil || sessionID != "laptop" || userID != "alice" || !reused {
+		t.Errorf("second spend = %q, %q, reused %v, %v, want reused", sessionID, userID, reused, err)
+	}
+
+	if _, _, _, err := SpendRefreshToken("unknown"); err == nil {
+		t.Error("spent an unknown refresh token")
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrNotFound is returned for keys that don't exist or have expired
+var ErrNotFound = errors.New("not found")
+
+// SessionStore keeps the short-lived state behind authentication: sessions,
+// refresh and API tokens, login challenges and throttling counters. Keys
+// hold either a value or a set of members and expire after their TTL; a TTL
+// of zero never expires.
+type SessionStore interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	// SetNX sets the key only if it doesn't exist and reports whether it did
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	// Delete removes keys and returns how many existed
+	Delete(keys ...string) (int, error)
+	// TTL is the time left before the key expires, or zero when it doesn't
+	// exist or never expires
+	TTL(key string) (time.Duration, error)
+	Expire(key string, ttl time.Duration) error
+	// Incr adds one to the counter at key, creating it at 1, and makes it
+	// expire ttl from now
+	Incr(key string, ttl time.Duration) (int64, error)
+	SAdd(key, member string) error
+	SRem(key, member string) error
+	SMembers(key string) ([]string, error)
+}
+
+var store SessionStore
+
+// InitSessionStore sets up the store selected by SESSION_STORE in
+// config.json: "redis" (the default), "rethinkdb" (the sessions table of the
+// database from InitDB) or "memory", which keeps nothing across restarts and
+// suits single-instance deployments and tests.
+func InitSessionStore() {
+	switch backend := viper.GetString("SESSION_STORE"); backend {
+	case "", "redis":
+		InitRedis()
+		store = NewRedisStore(redisClient)
+	case "rethinkdb":
+		if DB == nil {
+			log.Fatal("SESSION_STORE rethinkdb needs the database connection")
+		}
+		store = NewRethinkStore(DB, sweepInterval)
+	case "memory":
+		store = NewMemoryStore(sweepInterval)
+	default:
+		log.Fatalf("Unknown SESSION_STORE %q in config.json", backend)
+	}
+}
+
+// sweepInterval is how often expired keys are purged from stores that don't
+// expire keys themselves
+const sweepInterval = time.Minute
+
+// SetSessionStore replaces the store, e.g. with a MemoryStore in tests
+func SetSessionStore(s SessionStore) {
+	store = s
+}
+
+func GetSessionStore() SessionStore {
+	return store
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// useMemoryStore makes the package use a fresh MemoryStore for one test
+func useMemoryStore(t *testing.T) SessionStore {
+	previous := store
+	s := NewMemoryStore(time.Minute)
+	SetSessionStore(s)
+	t.Cleanup(func() { SetSessionStore(previous) })
+	return s
+}
+
+// testStoreContract checks the behaviour every SessionStore backend must have
+func testStoreContract(t *testing.T, s SessionStore) {
+	t.Run("values", func(t *testing.T) {
+		if _, err := s.Get("missing"); err != ErrNotFound {
+			t.Errorf("Get of a missing key: err = %v, want ErrNotFound", err)
+		}
+
+		if err := s.Set("value", []byte("one"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Get("value"); err != nil || string(got) != "one" {
+			t.Errorf("Get = %q, %v, want one", got, err)
+		}
+		if ttl, _ := s.TTL("value"); ttl != 0 {
+			t.Errorf("TTL of a key without expiry = %v, want 0", ttl)
+		}
+
+		if err := s.Set("value", []byte("two"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.Get("value"); string(got) != "two" {
+			t.Errorf("Get after overwrite = %q, want two", got)
+		}
+		if ttl, _ := s.TTL("value"); ttl <= 59*time.Minute || ttl > time.Hour {
+			t.Errorf("TTL = %v, want about an hour", ttl)
+		}
+	})
+
+	t.Run("setnx", func(t *testing.T) {
+		if first, err := s.SetNX("once", []byte("a"), time.Hour); err != nil || !first {
+			t.Errorf("first SetNX = %v, %v, want true", first, err)
+		}
+		if first, err := s.SetNX("once", []byte("b"), time.Hour); err != nil || first {
+			t.Errorf("second SetNX = %v, %v, want false", first, err)
+		}
+		if got, _ := s.Get("once"); string(got) != "a" {
+			t.Errorf("SetNX overwrote the value with %q", got)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s.Set("delete:a", []byte("a"), 0)
+		s.Set("delete:b", []byte("b"), 0)
+		if n, err := s.Delete("delete:a", "delete:b", "delete:missing"); err != nil || n != 2 {
+			t.Errorf("Delete = %d, %v, want 2", n, err)
+		}
+		if _, err := s.Get("delete:a"); err != ErrNotFound {
+			t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		s.Set("short", []byte("x"), 20*time.Millisecond)
+		s.Set("extended", []byte("x"), 20*time.Millisecond)
+		if err := s.Expire("extended", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		if _, err := s.Get("short"); err != ErrNotFound {
+			t.Errorf("Get of an expired key: err = %v, want ErrNotFound", err)
+		}
+		if ttl, _ := s.TTL("short"); ttl != 0 {
+			t.Errorf("TTL of an expired key = %v, want 0", ttl)
+		}
+		if n, _ := s.Delete("short"); n != 0 {
+			t.Errorf("Delete counted an expired key")
+		}
+		if _, err := s.Get("extended"); err != nil {
+			t.Errorf("Get of an extended key: %v", err)
+		}
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		for want := int64(1); want <= 3; want++ {
+			if got, err := s.Incr("counter", time.Hour); err != nil || got != want {
+				t.Errorf("Incr = %d, %v, want %d", got, err, want)
+			}
+		}
+		if got, _ := s.Get("counter"); string(got) != "3" {
+			t.Errorf("counter value = %q, want 3", got)
+		}
+
+		s.Incr("short-counter", 20*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		if got, _ := s.Incr("short-counter", time.Hour); got != 1 {
+			t.Errorf("Incr of an expired counter = %d, want 1", got)
+		}
+	})
+
+	t.Run("sets", func(t *testing.T) {
+		if members, err := s.SMembers("missing-set"); err != nil || len(members) != 0 {
+			t.Errorf("SMembers of a missing set = %v, %v, want none", members, err)
+		}
+
+		s.SAdd("set", "a")
+		s.SAdd("set", "b")
+		s.SAdd("set", "a")
+		s.SRem("set", "b")
+		s.SAdd("set", "c")
+
+		members, err := s.SMembers("set")
+		sort.Strings(members)
+		if err != nil || len(members) != 2 || members[0] != "a" || members[1] != "c" {
+			t.Errorf("SMembers = %v, %v, want [a c]", members, err)
+		}
+
+		s.Expire("set", 20*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		if members, _ := s.SMembers("set"); len(members) != 0 {
+			t.Errorf("SMembers of an expired set = %v, want none", members)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStoreContract(t, NewMemoryStore(time.Minute))
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RoleRequest struct {
+	Role string `json:"role" form:"role"`
+}
+
+type ActiveRequest struct {
+	Active bool `json:"active" form:"active"`
+}
+
+// UserPage is one page of a user search
+type UserPage struct {
+	Users []models.AppUser `json:"users"`
+	Total int              `json:"total"`
+	Page  int              `json:"page"`
+	Limit int              `json:"limit"`
+	Query string           `json:"query,omitempty"`
+}
+
+// PrevPage returns the number of the previous page, or 0 on the first page
+func (p UserPage) PrevPage() int {
+	return p.Page - 1
+}
+
+// NextPage returns the number of the next page, or 0 on the last page
+func (p UserPage) NextPage() int {
+	if p.Page*p.Limit >= p.Total {
+		return 0
+	}
+	return p.Page + 1
+}
+
+// searchUsers reads the q, page and limit query parameters and runs the search
+func searchUsers(c echo.Context, uc *repo.UserController) (UserPage, error) {
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := c.QueryParam("q")
+	users, total, err := uc.SearchUsers(query, page, limit)
+	return UserPage{Users: users, Total: total, Page: page, Limit: limit, Query: query}, err
+}
+
+// setUserActive activates or deactivates an account. Deactivation also ends
+// every session and revokes every API token of the user. Admins can't deactivate themselves.
+func setUserActive(c echo.Context, uc *repo.UserController, userID string, active bool) error {
+	if self, _ := currentUserID(c); !active && self == userID {
+		return fmt.Errorf("you cannot deactivate your own account")
+	}
+
+	if err := uc.SetUserDisabled(userID, !active); err != nil {
+		return err
+	}
+
+	if !active {
+		if err := revokeSessions(userID); err != nil {
+			log.Println("Error revoking sessions of deactivated user:", err)
+			return err
+		}
+		if err := revokeAPITokens(userID); err != nil {
+			log.Println("Error revoking API tokens of deactivated user:", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forceLogout ends every session of a user
+func forceLogout(uc *repo.UserController, userID string) error {
+	if _, err := uc.GetUserByUserid(userID); err != nil {
+		return err
+	}
+
+	if err := revokeSessions(userID); err != nil {
+		log.Println("Error revoking sessions:", err)
+		return err
+	}
+
+	return uc.SetUserActive(userID, false)
+}
+
+// unlockUser lifts a lockout caused by failed logins
+func unlockUser(uc *repo.UserController, userID string) error {
+	user, err := uc.GetUserByUserid(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := clearLoginFailures(user.Email); err != nil {
+		log.Println("Error clearing failed logins:", err)
+		return err
+	}
+
+	return nil
+}
+
+// adminDeleteUser deletes another user's account. Admins delete their own
+// account through the profile, which asks for their password.
+func adminDeleteUser(c echo.Context, uc *repo.UserController, userID, books, transferTo string) error {
+	self, _ := currentUserID(c)
+	if self == userID {
+		return fmt.Errorf("delete your own account from your profile")
+	}
+
+	user, err := uc.GetUserByUserid(userID)
+	if err != nil {
+		return err
+	}
+
+	return deleteAccount(uc, user, books, transferTo, self)
+}
+
+// ListUsers searches and paginates users
+func ListUsers(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		page, err := searchUsers(c, uc)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch users"})
+		}
+		return c.JSON(http.StatusOK, page)
+	}
+}
+
+// AdminGetUser retrieves any user's profile
+func AdminGetUser(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := uc.GetUserByUserid(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		user.Password = ""
+		return c.JSON(http.StatusOK, user)
+	}
+}
+
+// AdminSetRole changes a user's role
+func AdminSetRole(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(RoleRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid role"})
+		}
+
+		if err := uc.SetUserRole(c.Param("id"), req.Role); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"userid": c.Param("id"), "role": req.Role})
+	}
+}
+
+// AdminSetActive activates or deactivates a user's account
+func AdminSetActive(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(ActiveRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+
+		if err := setUserActive(c, uc, c.Param("id"), req.Active); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{"userid": c.Param("id"), "active": req.Active})
+	}
+}
+
+// AdminForceLogout ends every session of a user
+func AdminForceLogout(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := forceLogout(uc, c.Param("id")); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "user logged out"})
+	}
+}
+
+// AdminUnlockUser lifts a lockout caused by failed logins
+func AdminUnlockUser(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := unlockUser(uc, c.Param("id")); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "user unlocked"})
+	}
+}
+
+// AdminDeleteUser deletes a user's account, transferring or anonymizing their books
+func AdminDeleteUser(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(DeleteAccountRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+
+		if err := adminDeleteUser(c, uc, c.Param("id"), req.Books, req.TransferTo); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// AdminUsersPage renders the user list with search and pagination
+func AdminUsersPage(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title":   "Manage Users",
+			"Message": c.QueryParam("message"),
+			"Error":   c.QueryParam("error"),
+		}
+
+		page, err := searchUsers(c, uc)
+		if err != nil {
+			data["Error"] = "Failed to retrieve users"
+		}
+		data["Page"] = page
+
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
+
+// AdminUserPage renders any user's profile with the management actions
+func AdminUserPage(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title":   "Manage User",
+			"Message": c.QueryParam("message"),
+			"Error":   c.QueryParam("error"),
+		}
+
+		user, err := uc.GetUserByUserid(c.QueryParam("id"))
+		if err != nil {
+			data["Error"] = "User not found"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+		user.Password = ""
+
+		roles, err := uc.GetRoles()
+		if err != nil {
+			log.Println("Error fetching roles:", err)
+		}
+
+		data["User"] = user
+		data["Roles"] = roles
+		data["Locked"] = accountLocked(user.Email)
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
+
+// PostAdminUserAction handles the forms on the manage user page
+func PostAdminUserAction(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.FormValue("userId")
+
+		var err error
+		var message string
+		switch c.Param("action") {
+		case "role":
+			err = uc.SetUserRole(userID, c.FormValue("role"))
+			message = "Role updated"
+		case "activate":
+			err = setUserActive(c, uc, userID, true)
+			message = "Account activated"
+		case "deactivate":
+			err = setUserActive(c, uc, userID, false)
+			message = "Account deactivated"
+		case "logout":
+			err = forceLogout(uc, userID)
+			message = "User logged out"
+		case "unlock":
+			err = unlockUser(uc, userID)
+			message = "Account unlocked"
+		case "delete":
+			err = adminDeleteUser(c, uc, userID, c.FormValue("books"), c.FormValue("transferto"))
+			if err == nil {
+				return c.Redirect(http.StatusSeeOther, "/admin/users?message="+url.QueryEscape("User deleted"))
+			}
+		default:
+			err = fmt.Errorf("unknown action")
+		}
+
+		target := "/admin/users/view?id=" + url.QueryEscape(userID)
+		if err != nil {
+			return c.Redirect(http.StatusSeeOther, target+"&error="+url.QueryEscape(err.Error()))
+		}
+
+		return c.Redirect(http.StatusSeeOther, target+"&message="+url.QueryEscape(message))
+	}
+}
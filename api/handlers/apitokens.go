@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"rethink/api/db"
+	"rethink/api/middleware"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// apiTokenMaxDays limits how long an API token can be valid
+const apiTokenMaxDays = 365
+
+type APITokenRequest struct {
+	Name      string   `json:"name" form:"name"`
+	Scopes    []string `json:"scopes" form:"scopes"`
+	ExpiresIn int      `json:"expiresin" form:"expiresin"` // days, 30 by default
+}
+
+// NewAPIToken is a freshly created token. The secret is only ever shown here.
+type NewAPIToken struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+// viaAPIToken reports whether the request was authenticated with an API token
+func viaAPIToken(c echo.Context) bool {
+	principal, ok := middleware.CurrentPrincipal(c)
+	return ok && principal.ViaAPIToken()
+}
+
+// revokeAPITokens revokes every API token of a user
+func revokeAPITokens(userID string) error {
+	return db.DeleteUserAPITokens(userID)
+}
+
+// createAPIToken creates a token for the logged in user. Its scopes must be
+// privileges the user's role already has.
+func createAPIToken(c echo.Context, uc *repo.UserController, req *APITokenRequest) (*NewAPIToken, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, errors.New("unauthorized")
+	}
+	// Tokens can't mint tokens, or a narrow scope could be widened
+	if viaAPIToken(c) {
+		return nil, errors.New("log in to create API tokens")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, errors.New("choose at least one scope")
+	}
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = 30
+	}
+	if req.ExpiresIn < 1 || req.ExpiresIn > apiTokenMaxDays {
+		return nil, fmt.Errorf("expiresin must be between 1 and %d days", apiTokenMaxDays)
+	}
+
+	user, err := uc.GetUserByUserid(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	privileges, err := uc.GetRolePrivileges(user.Role)
+	if err != nil {
+		log.Println("Error fetching role privileges:", err)
+		return nil, errors.New("failed to verify scopes")
+	}
+	for _, scope := range req.Scopes {
+		if !contains(privileges, scope) {
+			return nil, fmt.Errorf("your role does not have the %q privilege", scope)
+		}
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	secret = db.APITokenPrefix + secret
+
+	token := models.APIToken{
+		ID:        uuid.New().String(),
+		Userid:    user.Userid,
+		Email:     user.Email,
+		Name:      req.Name,
+		Prefix:    secret[:len(db.APITokenPrefix)+8],
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresIn),
+	}
+	if err := db.CreateAPIToken(secret, &token); err != nil {
+		log.Println("Error storing API token:", err)
+		return nil, errors.New("failed to create token")
+	}
+
+	return &NewAPIToken{APIToken: token, Token: secret}, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeAPIToken revokes one of the logged in user's tokens
+func revokeAPIToken(c echo.Context, id string) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return errors.New("unauthorized")
+	}
+	return db.DeleteAPIToken(userID, id)
+}
+
+// ListAPITokens lists the logged in user's API tokens
+func ListAPITokens() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+
+		tokens, err := db.ListAPITokens(userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list tokens"})
+		}
+		return c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// CreateAPIToken creates an API token and returns it with its secret
+func CreateAPIToken(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(APITokenRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+
+		token, err := createAPIToken(c, uc, req)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusCreated, token)
+	}
+}
+
+// RevokeAPIToken revokes one of the logged in user's API tokens
+func RevokeAPIToken() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := revokeAPIToken(c, c.Param("id")); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// APITokensPage renders the logged in user's API tokens with a form to
+// create one. A new token's secret is passed in newToken to show it once.
+func APITokensPage(c echo.Context, uc *repo.UserController, newToken *NewAPIToken) error {
+	data := map[string]interface{}{
+		"Title":    "API Tokens",
+		"Message":  c.QueryParam("message"),
+		"Error":    c.QueryParam("error"),
+		"NewToken": newToken,
+	}
+
+	userID, _ := currentUserID(c)
+	tokens, err := db.ListAPITokens(userID)
+	if err != nil {
+		data["Error"] = "Failed to retrieve tokens"
+	}
+	data["Tokens"] = tokens
+
+	if user, err := uc.GetUserByUserid(userID); err == nil {
+		data["Scopes"], _ = uc.GetRolePrivileges(user.Role)
+	}
+
+	return c.Render(http.StatusOK, "layout.html", data)
+}
+
+// PostAPITokenAction handles the forms on the API tokens page
+func PostAPITokenAction(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Param("action") {
+		case "create":
+			req := new(APITokenRequest)
+			c.Bind(req)
+
+			token, err := createAPIToken(c, uc, req)
+			if err != nil {
+				return c.Redirect(http.StatusSeeOther, "/user/tokens?error="+url.QueryEscape(err.Error()))
+			}
+			return APITokensPage(c, uc, token)
+		case "revoke":
+			if err := revokeAPIToken(c, c.FormValue("tokenId")); err != nil {
+				return c.Redirect(http.StatusSeeOther, "/user/tokens?error="+url.QueryEscape(err.Error()))
+			}
+			return c.Redirect(http.StatusSeeOther, "/user/tokens?message="+url.QueryEscape("Token revoked"))
+		default:
+			return c.Redirect(http.StatusSeeOther, "/user/tokens?error="+url.QueryEscape("unknown action"))
+		}
+	}
+}
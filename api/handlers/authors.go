@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuthorRequest struct {
+	Name      string `json:"name" form:"name"`
+	Bio       string `json:"bio" form:"bio"`
+	BirthYear int    `json:"birthyear" form:"birthyear"`
+}
+
+type MergeAuthorRequest struct {
+	Duplicate string `json:"duplicate" form:"duplicate"`
+}
+
+// AuthorWithBooks is an author together with the books they are credited on
+type AuthorWithBooks struct {
+	models.Author
+	Books []models.Books `json:"books"`
+}
+
+// GetAuthors retrieves all authors
+func GetAuthors(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		authors, err := ac.GetAuthors()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, authors)
+	}
+}
+
+// GetAuthor retrieves an author with their books
+func GetAuthor(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		author, err := ac.GetAuthor(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		books, err := ac.GetAuthorBooks(author.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "database error"})
+		}
+
+		return c.JSON(http.StatusOK, AuthorWithBooks{Author: *author, Books: books})
+	}
+}
+
+// CreateAuthor adds a new author
+func CreateAuthor(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(AuthorRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid author data"})
+		}
+
+		author, err := ac.CreateAuthor(models.Author{Name: req.Name, Bio: req.Bio, BirthYear: req.BirthYear})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusCreated, author)
+	}
+}
+
+// UpdateAuthor updates an author's details
+func UpdateAuthor(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(AuthorRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid author data"})
+		}
+
+		author, err := ac.UpdateAuthor(c.Param("id"), models.Author{Name: req.Name, Bio: req.Bio, BirthYear: req.BirthYear})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, author)
+	}
+}
+
+// DeleteAuthor removes an author who is not credited on any book
+func DeleteAuthor(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := ac.DeleteAuthor(c.Param("id")); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// MergeAuthor folds a duplicate author into the author in the URL
+func MergeAuthor(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(MergeAuthorRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid merge request"})
+		}
+
+		if err := ac.MergeAuthors(c.Param("id"), req.Duplicate); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "authors merged"})
+	}
+}
+
+// AuthorsPage renders the author list with the create form
+func AuthorsPage(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title":   "Authors",
+			"Message": c.QueryParam("message"),
+			"Error":   c.QueryParam("error"),
+		}
+
+		authors, err := ac.GetAuthors()
+		if err != nil {
+			data["Error"] = "Failed to retrieve authors"
+		}
+		data["Authors"] = authors
+
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
+
+// AuthorPage renders an author's details and the books they are credited on
+func AuthorPage(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title": "Author Details",
+		}
+
+		author, err := ac.GetAuthor(c.QueryParam("id"))
+		if err != nil {
+			data["Error"] = "Author not found"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		books, err := ac.GetAuthorBooks(author.ID)
+		if err != nil {
+			data["Error"] = "Failed to retrieve books"
+		}
+
+		data["Author"] = author
+		data["Books"] = books
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
+
+// PostAuthor handles the create author form
+func PostAuthor(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		birthYear, _ := strconv.Atoi(c.FormValue("birthyear"))
+
+		_, err := ac.CreateAuthor(models.Author{
+			Name:      c.FormValue("name"),
+			Bio:       c.FormValue("bio"),
+			BirthYear: birthYear,
+		})
+		if err != nil {
+			return c.Redirect(http.StatusSeeOther, "/authors/all?error=Failed+to+create+author")
+		}
+
+		return c.Redirect(http.StatusSeeOther, "/authors/all?message=Author+created")
+	}
+}
+
+// PostMergeAuthors handles the merge duplicate authors form
+func PostMergeAuthors(ac *repo.AuthorController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := ac.MergeAuthors(c.FormValue("keep"), c.FormValue("duplicate")); err != nil {
+			return c.Redirect(http.StatusSeeOther, "/authors/all?error="+url.QueryEscape(err.Error()))
+		}
+
+		return c.Redirect(http.StatusSeeOther, "/authors/id?id="+url.QueryEscape(c.FormValue("keep")))
+	}
+}
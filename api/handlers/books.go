@@ -10,16 +10,30 @@ import (
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 	r "github.com/rethinkdb/rethinkdb-go"
 )
 
+// formAuthorIDs reads the selected author IDs from the submitted form. The
+// second result reports whether the form carried the field at all.
+func formAuthorIDs(c echo.Context) ([]string, bool) {
+	values, ok := c.Request().Form["authorIds"]
+	IDs := []string{}
+	for _, value := range values {
+		for _, ID := range strings.Split(value, ",") {
+			if ID = strings.TrimSpace(ID); ID != "" {
+				IDs = append(IDs, ID)
+			}
+		}
+	}
+	return IDs, ok
+}
+
 // GetbooksHandler retrieves all books
 func Getbooks(bc *repo.BookController) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		log.Println("Handling /books GET request...")
-		books, err := bc.GetBooks()
+		books, err := bc.GetBooksSorted(c.QueryParam("sort"))
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
@@ -52,33 +66,13 @@ func Getbook(bc *repo.BookController) echo.HandlerFunc {
 func Createbook(bc *repo.BookController) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
-		// Retrieve the token from the cookie instead of the Authorization header
-		cookie, err := c.Cookie("Authorization")
-		if err != nil {
-			fmt.Println("Error: Authorization cookie missing")
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authorization token missing"})
-		}
-
-		// Extract the token from "Bearer <token>"
-		tokenString := strings.TrimPrefix(cookie.Value, "Bearer ")
-
-		// Debugging: Print extracted token
-		fmt.Println("Extracted Token:", tokenString)
-
 		// Retrieve user from context
-		userClaims, exists := c.Get("user").(jwt.MapClaims)
+		userID, exists := currentUserID(c)
 		if !exists {
 			fmt.Println("Error: User context is missing")
 			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
 		}
 
-		// Extract user ID from claims
-		userID, exists := userClaims["userid"].(string)
-		if !exists {
-			fmt.Println("Error: userid not found in claims")
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token format"})
-		}
-
 		// Debugging: Output the user ID from token claims
 		fmt.Println("Authenticated User ID:", userID)
 
@@ -92,6 +86,12 @@ func Createbook(bc *repo.BookController) echo.HandlerFunc {
 		var book models.Books
 		book.Title = c.FormValue("title")
 		book.Description = c.FormValue("description")
+		book.AuthorIDs, _ = formAuthorIDs(c)
+
+		// Books may only credit authors that exist
+		if err := repo.NewAuthorController(bc.Session).CheckAuthors(book.AuthorIDs); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
 
 		// Find max bookid and increment it by 1, handling empty table case
 		var maxID int
@@ -143,19 +143,12 @@ func Createbook(bc *repo.BookController) echo.HandlerFunc {
 func Updatebook(bc *repo.BookController) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		// Retrieve user from context
-		userClaims, exists := c.Get("user").(jwt.MapClaims)
+		userID, exists := currentUserID(c)
 		if !exists {
 			fmt.Println("Error: User context is missing")
 			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
 		}
 
-		// Extract user ID from claims
-		userID, exists := userClaims["userid"].(string)
-		if !exists {
-			fmt.Println("Error: userid not found in claims")
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token format"})
-		}
-
 		// Debugging: Output the user ID from token claims
 		fmt.Println("Authenticated User ID:", userID)
 
@@ -171,6 +164,15 @@ func Updatebook(bc *repo.BookController) echo.HandlerFunc {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "book not found"})
 		}
 
+		// Keep the current authors unless the form sends a new selection
+		authorIDs, sent := formAuthorIDs(c)
+		if !sent {
+			authorIDs = userData.AuthorIDs
+		}
+		if err := repo.NewAuthorController(bc.Session).CheckAuthors(authorIDs); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
 		// Manually extract form values
 		updatedBook := models.Books{
 			Title:       c.FormValue("title"),
@@ -180,6 +182,9 @@ func Updatebook(bc *repo.BookController) echo.HandlerFunc {
 			CreatedBy:   userData.CreatedBy,
 			CreatedAt:   userData.CreatedAt,
 			BookID:      userData.BookID,
+			RatingAvg:   userData.RatingAvg,
+			RatingCount: userData.RatingCount,
+			AuthorIDs:   authorIDs,
 		}
 
 		// Debugging: Print extracted values
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CopyRequest struct {
+	Barcode    string `json:"barcode" form:"barcode"`
+	Location   string `json:"location" form:"location"`
+	Condition  string `json:"condition" form:"condition"`
+	AcquiredAt string `json:"acquiredat" form:"acquiredat"`
+	Status     string `json:"status" form:"status"`
+}
+
+type CopyStatusRequest struct {
+	Status string `json:"status" form:"status"`
+	Note   string `json:"note" form:"note"`
+}
+
+// toCopy converts the request into a copy, parsing the acquisition date (YYYY-MM-DD)
+func (req *CopyRequest) toCopy() (models.Copy, error) {
+	copyData := models.Copy{
+		Barcode:   req.Barcode,
+		Location:  req.Location,
+		Condition: req.Condition,
+		Status:    req.Status,
+	}
+
+	if req.AcquiredAt != "" {
+		acquiredAt, err := time.Parse("2006-01-02", req.AcquiredAt)
+		if err != nil {
+			return copyData, err
+		}
+		copyData.AcquiredAt = acquiredAt
+	}
+
+	return copyData, nil
+}
+
+// GetCopies lists the physical copies of a book
+func GetCopies(cc *repo.CopyController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		BookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid book ID"})
+		}
+
+		copies, err := cc.GetCopies(BookID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, copies)
+	}
+}
+
+// GetCopy retrieves a single copy
+func GetCopy(cc *repo.CopyController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		copyData, err := cc.GetCopy(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, copyData)
+	}
+}
+
+// CreateCopy adds a physical copy to a book
+func CreateCopy(cc *repo.CopyController, bc *repo.BookController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		BookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid book ID"})
+		}
+
+		if _, err := bc.GetBook(BookID); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "book not found"})
+		}
+
+		req := new(CopyRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid copy data"})
+		}
+
+		copyData, err := req.toCopy()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid date format. Use YYYY-MM-DD"})
+		}
+		copyData.BookID = BookID
+
+		created, err := cc.CreateCopy(copyData, userID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusCreated, created)
+	}
+}
+
+// UpdateCopy updates a copy's details
+func UpdateCopy(cc *repo.CopyController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		req := new(CopyRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid copy data"})
+		}
+
+		copyData, err := req.toCopy()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid date format. Use YYYY-MM-DD"})
+		}
+
+		updated, err := cc.UpdateCopy(c.Param("id"), copyData, userID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, updated)
+	}
+}
+
+// SetCopyStatus changes the status of a copy
+func SetCopyStatus(cc *repo.CopyController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		req := new(CopyStatusRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid status"})
+		}
+
+		updated, err := cc.SetStatus(c.Param("id"), req.Status, userID, req.Note)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, updated)
+	}
+}
+
+// DeleteCopy removes a copy
+func DeleteCopy(cc *repo.CopyController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		if err := cc.DeleteCopy(c.Param("id"), userID); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// GetCopyAudit lists the status history of a copy
+func GetCopyAudit(cc *repo.CopyController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		entries, err := cc.GetCopyAudit(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rethink/api/auth"
+	"rethink/api/db"
+	"rethink/api/mail"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// exportTTL is how long a finished export and its download link stay available
+const exportTTL = 24 * time.Hour
+
+// exportDir is where export archives are written, set by EXPORT_DIR
+func exportDir() string {
+	dir := viper.GetString("EXPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "rethink-exports")
+	}
+	return dir
+}
+
+func exportPath(id string) string {
+	return filepath.Join(exportDir(), id+".zip")
+}
+
+// saveExportJob stores the job state in the session store; it expires with
+// the export
+func saveExportJob(job *models.ExportJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return db.GetSessionStore().Set("export:"+job.ID, data, exportTTL)
+}
+
+func getExportJob(id string) (*models.ExportJob, error) {
+	data, err := db.GetSessionStore().Get("export:" + id)
+	if err != nil {
+		return nil, errors.New("export not found or expired")
+	}
+
+	var job models.ExportJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// exportDownloadURL signs a download link that expires with the export
+func exportDownloadURL(job *models.ExportJob) (string, error) {
+	claims := jwt.MapClaims{
+		"purpose":  "data_export",
+		"exportid": job.ID,
+		"userid":   job.Userid,
+		"exp":      job.CreatedAt.Add(exportTTL).Unix(),
+	}
+
+	key, err := auth.Secret()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		return "", err
+	}
+
+	return appURL() + "/exports/" + job.ID + "?token=" + url.QueryEscape(token), nil
+}
+
+// checkExportToken verifies a download link token for the export
+func checkExportToken(id, tokenString string) error {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return auth.Secret()
+	})
+	if err != nil || !token.Valid {
+		return errors.New("invalid or expired download link")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "data_export" || claims["exportid"] != id {
+		return errors.New("invalid download link")
+	}
+
+	return nil
+}
+
+// sweepExports removes archives older than the export TTL
+func sweepExports() {
+	entries, err := os.ReadDir(exportDir())
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < exportTTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(exportDir(), entry.Name())); err != nil {
+			log.Println("Error removing expired export:", err)
+		}
+	}
+}
+
+// toCSV flattens a record or a list of records into CSV with one column per
+// JSON field. Nested values are written as JSON and text that a spreadsheet
+// would run as a formula is quoted.
+func toCSV(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		var row map[string]interface{}
+		if err := json.Unmarshal(data, &row); err != nil {
+			return nil, err
+		}
+		rows = []map[string]interface{}{row}
+	}
+
+	columns := map[string]bool{}
+	for _, row := range rows {
+		for key := range row {
+			columns[key] = true
+		}
+	}
+	header := make([]string, 0, len(columns))
+	for key := range columns {
+		header = append(header, key)
+	}
+	sort.Strings(header)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, key := range header {
+			switch value := row[key].(type) {
+			case nil:
+			case string:
+				record[i] = csvCell(value)
+			case map[string]interface{}, []interface{}:
+				nested, _ := json.Marshal(value)
+				record[i] = string(nested)
+			default:
+				record[i] = fmt.Sprint(value)
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+// writeExportZip writes each part of the export as JSON and CSV
+func writeExportZip(path string, data *models.UserExport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	parts := []struct {
+		name  string
+		value interface{}
+	}{
+		{"user", data.User},
+		{"books", data.Books},
+		{"reviews", data.Reviews},
+		{"reading_lists", data.ReadingLists},
+		{"sessions", data.Sessions},
+		{"user_audit", data.UserAudit},
+		{"copy_audit", data.CopyAudit},
+	}
+
+	for _, part := range parts {
+		jsonData, err := json.MarshalIndent(part.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		csvData, err := toCSV(part.value)
+		if err != nil {
+			return err
+		}
+
+		files := []struct {
+			name    string
+			content []byte
+		}{
+			{part.name + ".json", jsonData},
+			{part.name + ".csv", csvData},
+		}
+		for _, f := range files {
+			w, err := archive.Create(f.name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(f.content); err != nil {
+				return err
+			}
+		}
+	}
+
+	return archive.Close()
+}
+
+// buildExport generates the archive for a job and emails the download link
+func buildExport(ec *repo.ExportController, job *models.ExportJob, email string) {
+	sweepExports()
+
+	data, err := ec.GetUserData(job.Userid)
+	if err == nil {
+		if sessions, err := db.ListSessions(job.Userid); err == nil {
+			data.Sessions = sessions
+		}
+		err = writeExportZip(exportPath(job.ID), data)
+	}
+
+	job.CompletedAt = time.Now()
+	if err != nil {
+		log.Println("Error generating data export:", err)
+		job.Status = models.ExportFailed
+		job.Error = "failed to generate export"
+	} else {
+		job.Status = models.ExportReady
+	}
+
+	if err := saveExportJob(job); err != nil {
+		log.Println("Error saving export job:", err)
+		return
+	}
+
+	if job.Status != models.ExportReady {
+		return
+	}
+
+	link, err := exportDownloadURL(job)
+	if err != nil {
+		log.Println("Error signing export link:", err)
+		return
+	}
+
+	err = mail.GetMailer().Send(mail.Message{
+		To:      email,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf("Your personal data export is ready. Download it from the link below:\n\n%s\n\nThe link expires in %d hours.",
+			link, int(exportTTL.Hours())),
+	})
+	if err != nil {
+		log.Println("Error sending export email:", err)
+	}
+}
+
+// startExport queues an export of the logged in user's data
+func startExport(c echo.Context, uc *repo.UserController, ec *repo.ExportController) (*models.ExportJob, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, errors.New("unauthorized")
+	}
+
+	user, err := uc.GetUserByUserid(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.ExportJob{
+		ID:        uuid.New().String(),
+		Userid:    userID,
+		Status:    models.ExportPending,
+		CreatedAt: time.Now(),
+	}
+	if err := saveExportJob(job); err != nil {
+		log.Println("Error saving export job:", err)
+		return nil, errors.New("failed to start export")
+	}
+
+	go buildExport(ec, job, user.Email)
+	return job, nil
+}
+
+// StartExport queues a personal data export and returns the job
+func StartExport(uc *repo.UserController, ec *repo.ExportController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		job, err := startExport(c, uc, ec)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// ExportStatus reports the state of one of the user's exports, with the
+// download link once it is ready
+func ExportStatus() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, _ := currentUserID(c)
+
+		job, err := getExportJob(c.Param("id"))
+		if err != nil || job.Userid != userID {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "export not found or expired"})
+		}
+
+		if job.Status == models.ExportReady {
+			if job.DownloadURL, err = exportDownloadURL(job); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to sign download link"})
+			}
+		}
+
+		return c.JSON(http.StatusOK, job)
+	}
+}
+
+// DownloadExport serves a finished export to anyone holding a valid link
+func DownloadExport() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		if err := checkExportToken(id, c.QueryParam("token")); err != nil {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		}
+
+		job, err := getExportJob(id)
+		if err != nil || job.Status != models.ExportReady {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "export not found or expired"})
+		}
+
+		return c.Attachment(exportPath(job.ID), "data-export-"+job.CreatedAt.Format("2006-01-02")+".zip")
+	}
+}
+
+// PostExport handles the request export form
+func PostExport(uc *repo.UserController, ec *repo.ExportController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title": "Export My Data",
+		}
+
+		if _, err := startExport(c, uc, ec); err != nil {
+			data["Error"] = err.Error()
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		data["Message"] = "Your export is being prepared. We'll email you a download link when it's ready."
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
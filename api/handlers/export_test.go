@@ -0,0 +1,18 @@
+package handlers
+
+import "testing"
+
+func TestToCSVEscapesFormulas(t *testing.T) {
+	data, err := toCSV([]map[string]interface{}{
+		{"title": "=cmd|' /C calc'!A0", "rating": -1},
+		{"title": "Dune", "rating": 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "rating,title\n-1,'=cmd|' /C calc'!A0\n5,Dune\n"
+	if string(data) != want {
+		t.Errorf("toCSV =\n%s\nwant\n%s", data, want)
+	}
+}
@@ -1,179 +1,280 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"rethink/api/auth"
 	"rethink/api/db"
+	"rethink/api/middleware"
 	"rethink/api/models"
 	"rethink/api/repo"
+	"rethink/api/security"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/spf13/viper"
 )
 
-// Secret key (should be from environment variables)
-func getJWTSecret() string {
-	err := viper.ReadInConfig()
-	if err != nil {
-		log.Fatal("Error reading config file:", err)
+// accessTokenTTL is how long an access token is valid. Clients renew it
+// with their refresh token at /token/refresh.
+const accessTokenTTL = 15 * time.Minute
+
+// TokenPair is an access token together with the refresh token that renews it
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshtoken"`
+	ExpiresIn    int    `json:"expiresin"`
+}
+
+// hashToken is how opaque tokens are stored, so a leaked session store can't
+// be replayed
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns a random opaque token
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Generate JWT Token (Private Function). Each login opens a new session,
+// recorded with the device's user agent and IP address.
+func generateJWT(user *models.AppUser, userAgent, ip string) (*TokenPair, error) {
+	session := &models.Session{
+		ID:        uuid.New().String(),
+		Userid:    user.Userid,
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: time.Now(),
+		LastSeen:  time.Now(),
+		ExpiresAt: time.Now().Add(db.SessionTTL),
 	}
 
-	secret := viper.GetString("JWT_SECRET")
-	if secret == "" {
-		log.Fatal("JWT_SECRET not found in config file")
+	// Store the session
+	if err := db.CreateSession(session); err != nil {
+		log.Println("Error storing session:", err)
+		return nil, err
 	}
 
-	return secret
+	return issueTokens(user, session)
 }
 
-// Generate JWT Token (Private Function)
-func generateJWT(user *models.AppUser) (string, error) {
-	secret := getJWTSecret()
-	claims := &jwt.MapClaims{
-		"userid":    user.Userid,
-		"email":     user.Email,
-		"name":      user.Name,
-		"role":      user.Role,
-		"expiresAt": time.Now().Add(time.Hour * 24).Unix(), // Expires in 24 hours
+// issueTokens signs a short-lived access token for the session and stores a
+// new single-use refresh token for it
+func issueTokens(user *models.AppUser, session *models.Session) (*TokenPair, error) {
+	claims := auth.NewClaims(user.Userid, user.Email, user.Name, user.Role, session.ID, accessTokenTTL)
+	tokenString, err := auth.SignToken(claims)
+	if err != nil {
+		fmt.Println("Error signing JWT:", err)
+		return nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
+	refresh, err := randomToken()
 	if err != nil {
-		fmt.Println("Error signing JWT:", err)
-		return "", err
+		return nil, err
+	}
+	if err := db.StoreRefreshToken(hashToken(refresh), session); err != nil {
+		log.Println("Error storing refresh token:", err)
+		return nil, err
 	}
 
-	// Store token in Redis
-	redisClient := db.GetRedisClient()
-	err = redisClient.Set("jwt:"+user.Userid, tokenString, time.Hour*24).Err() // Store for 24 hours
+	return &TokenPair{
+		AccessToken:  tokenString,
+		RefreshToken: refresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// newSessionToken issues tokens for a new session on the requesting device
+func newSessionToken(c echo.Context, user *models.AppUser) (*TokenPair, error) {
+	return generateJWT(user, c.Request().UserAgent(), c.RealIP())
+}
 
+// setAuthCookies stores the tokens in the browser. The refresh token is only
+// sent to the refresh endpoint.
+func setAuthCookies(c echo.Context, pair *TokenPair) {
+	c.SetCookie(&http.Cookie{
+		Name:     "Authorization",
+		Value:    "Bearer " + pair.AccessToken,
+		HttpOnly: true,
+		Secure:   middleware.SecureCookies(),
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+	c.SetCookie(&http.Cookie{
+		Name:     "Refresh",
+		Value:    pair.RefreshToken,
+		HttpOnly: true,
+		Secure:   middleware.SecureCookies(),
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/token",
+		Expires:  time.Now().Add(db.SessionTTL),
+	})
+}
+
+// clearAuthCookies removes the tokens from the browser
+func clearAuthCookies(c echo.Context) {
+	for _, cookie := range []struct{ name, path string }{{"Authorization", "/"}, {"Refresh", "/token"}} {
+		c.SetCookie(&http.Cookie{
+			Name:     cookie.name,
+			Value:    "",
+			Expires:  time.Unix(0, 0),
+			Path:     cookie.path,
+			HttpOnly: true,
+			Secure:   middleware.SecureCookies(),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// refreshTokens spends a refresh token and issues a new pair for its session.
+// Presenting a token that was already spent means it was stolen or replayed,
+// so the whole session is revoked.
+func refreshTokens(c echo.Context, uc *repo.UserController, refresh string) (*TokenPair, error) {
+	sid, userID, reused, err := db.SpendRefreshToken(hashToken(refresh))
 	if err != nil {
-		log.Println("Error storing token in Redis:", err)
-		//return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to store token"})
-	} else {
-		log.Println("Token stored successfully.")
+		return nil, errors.New("invalid refresh token")
+	}
+
+	if reused {
+		security.Event("refresh_token_reuse", "userid", userID, "session", sid, "ip", c.RealIP())
+		if err := db.DeleteSession(userID, sid); err != nil {
+			log.Println("Error revoking session after refresh token reuse:", err)
+		}
+		return nil, errors.New("refresh token already used")
+	}
+
+	session, err := db.GetSession(sid)
+	if err != nil || session.Userid != userID {
+		return nil, errors.New("session expired or revoked")
+	}
+
+	user, err := uc.GetUserByUserid(userID)
+	if err != nil || user.Disabled {
+		db.DeleteSession(userID, sid)
+		return nil, errors.New("session expired or revoked")
+	}
+
+	if err := db.ExtendSession(session); err != nil {
+		return nil, err
 	}
 
-	return tokenString, nil
+	return issueTokens(user, session)
 }
 
-// GenerateJWTHandler generates a JWT token for a user
-func GenerateJWTHandler(uc *repo.UserController) echo.HandlerFunc {
+// RefreshToken exchanges a refresh token, from the body or the Refresh
+// cookie, for a new token pair
+func RefreshToken(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		req := new(struct {
+			RefreshToken string `json:"refreshtoken" form:"refreshtoken"`
+		})
+		c.Bind(req)
 
-		// Get user ID from query parameters
-		userID := c.QueryParam("userid")
-		if userID == "" {
-			// Log missing userid
-			fmt.Println("Error: userid is missing in the query")
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "userid is required"})
-		}
-
-		// Fetch user details
-		user, err := uc.GetUserByEmail(userID)
-		if err != nil {
-			// Log if the user is not found
-			fmt.Println("Error: user not found,", err)
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		if req.RefreshToken == "" {
+			if cookie, err := c.Cookie("Refresh"); err == nil {
+				req.RefreshToken = cookie.Value
+			}
 		}
 
-		// Generate a JWT token for the user
-		token, err := generateJWT(user)
+		pair, err := refreshTokens(c, uc, req.RefreshToken)
 		if err != nil {
-			// Log if token generation fails
-			fmt.Println("Error generating JWT:", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate token"})
+			clearAuthCookies(c)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
 		}
 
-		// Return the JWT token in the response
-		return c.JSON(http.StatusOK, map[string]string{"token": token})
+		setAuthCookies(c, pair)
+		return c.JSON(http.StatusOK, pair)
 	}
 }
 
-// ValidateJWT parses and validates the JWT token
-func ValidateJWT(tokenString string) (map[string]interface{}, error) {
-	secret := getJWTSecret()
+// RefreshRedirect renews the browser's cookies and returns to the page that
+// found its access token expired
+func RefreshRedirect(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cookie, err := c.Cookie("Refresh")
+		if err != nil {
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+		pair, err := refreshTokens(c, uc, cookie.Value)
+		if err != nil {
+			clearAuthCookies(c)
+			return c.Redirect(http.StatusSeeOther, "/login")
 		}
-		return []byte(secret), nil
-	})
+		setAuthCookies(c, pair)
 
-	if err != nil {
-		log.Println("JWT Validation Error:", err)
-		return nil, err
+		// Only redirect within this site
+		next := c.QueryParam("next")
+		if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+			next = "/boks"
+		}
+		return c.Redirect(http.StatusSeeOther, next)
 	}
+}
 
-	// Extract claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		log.Println("Decoded JWT Claims:", claims) // Debugging
-		return claims, nil
+// currentSessionID returns the session of the request's token
+func currentSessionID(c echo.Context) string {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return ""
 	}
+	return principal.SessionID
+}
 
-	log.Println("Invalid Token Received")
-	return nil, errors.New("invalid token")
+// revokeSessions ends every session of a user so none of their tokens authenticate
+func revokeSessions(userID string) error {
+	return db.DeleteUserSessions(userID, "")
 }
 
-// Middleware to check JWT authentication
-func CheckJWT(next echo.HandlerFunc) echo.HandlerFunc {
+// GenerateJWTHandler generates a JWT token for a user
+func GenerateJWTHandler(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		authHeader := c.Request().Header.Get("Authorization")
-		if authHeader == "" {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing token"})
-		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == "" {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token format"})
+		// Get user ID from query parameters
+		userID := c.QueryParam("userid")
+		if userID == "" {
+			// Log missing userid
+			fmt.Println("Error: userid is missing in the query")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "userid is required"})
 		}
 
-		// Validate JWT
-		_, err := ValidateJWT(tokenString)
+		// Fetch user details
+		user, err := uc.GetUserByEmail(userID)
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+			// Log if the user is not found
+			fmt.Println("Error: user not found,", err)
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
 		}
 
-		return next(c)
-	}
-}
-
-// GetClaims decodes the JWT token and returns the claims
-func GetClaims(token string) (jwt.MapClaims, error) {
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		// Validate signing method and return the secret key
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
+		// Generate a JWT token for the user
+		pair, err := newSessionToken(c, user)
+		if err != nil {
+			// Log if token generation fails
+			fmt.Println("Error generating JWT:", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate token"})
 		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-	if err != nil {
-		return nil, err
-	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok || !parsedToken.Valid {
-		return nil, fmt.Errorf("invalid token")
+		// Return the JWT tokens in the response
+		return c.JSON(http.StatusOK, pair)
 	}
-	return claims, nil
 }
 
-// extracts jwt token from authorization header
-func GetJWTFromHeader(c echo.Context) string {
-	authHeader := c.Request().Header.Get("Authorization")
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		return strings.TrimPrefix(authHeader, "Bearer ")
+// JWKS publishes the public keys that verify our access tokens
+func JWKS() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSON(http.StatusOK, auth.JWKS())
 	}
-
-	token := strings.Split(authHeader, " ")[1]
-
-	return token
 }
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"rethink/api/auth"
+	"rethink/api/db"
+	"rethink/api/middleware"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"rethink/api/security"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// oidcLoginTTL is how long a user has to finish signing in at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcLogin is what we remember about a sign-in between sending the browser
+// to the provider and it coming back, stored under "oidc:<state>"
+type oidcLogin struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// oidcProvider returns the configured SSO provider, or nil when SSO is off
+func oidcProvider() *auth.OIDCProvider {
+	return auth.OIDC(appURL() + "/login/oidc/callback")
+}
+
+// oidcGroupsClaim names the ID token claim with the user's groups, set by
+// OIDC_GROUPS_CLAIM
+func oidcGroupsClaim() string {
+	claim := viper.GetString("OIDC_GROUPS_CLAIM")
+	if claim == "" {
+		claim = "groups"
+	}
+	return claim
+}
+
+// oidcRole maps the user's IdP groups to a role through OIDC_ROLE_MAP. When
+// several groups map, the most privileged role wins.
+func oidcRole(uc *repo.UserController, groups []string) (string, bool) {
+	// viper lowercases map keys, so groups are matched case-insensitively
+	roleMap := viper.GetStringMapString("OIDC_ROLE_MAP")
+	mapped := map[string]bool{}
+	for _, group := range groups {
+		if role, ok := roleMap[strings.ToLower(group)]; ok {
+			mapped[role] = true
+		}
+	}
+	if len(mapped) == 0 {
+		return "", false
+	}
+
+	roles, err := uc.GetRoles()
+	if err != nil {
+		log.Println("Error fetching roles for SSO role mapping:", err)
+		return "", false
+	}
+	for _, role := range roles {
+		if mapped[role.Role] {
+			return role.Role, true
+		}
+	}
+	return "", false
+}
+
+// oidcUser finds the user with the ID token's verified email, creating them
+// on their first SSO login with the role mapped from their groups. Existing
+// users keep the role an admin gave them unless OIDC_ROLE_SYNC is on, in
+// which case the mapped role replaces it at every sign-in.
+func oidcUser(uc *repo.UserController, id *auth.IDToken) (*models.AppUser, error) {
+	if id.Email == "" || !id.EmailVerified {
+		return nil, errors.New("your identity provider did not confirm your email address")
+	}
+
+	role, mapped := oidcRole(uc, id.Groups)
+
+	user, err := uc.GetUserByEmail(id.Email)
+	if err != nil {
+		return provisionOIDCUser(uc, id, role, mapped)
+	}
+
+	if user.Disabled {
+		return nil, errors.New("this account has been deactivated")
+	}
+	if !user.Verified {
+		if err := uc.MarkEmailVerified(user.Userid); err != nil {
+			log.Println("Error marking SSO user verified:", err)
+		}
+		user.Verified = true
+	}
+	if mapped && role != user.Role && viper.GetBool("OIDC_ROLE_SYNC") {
+		if err := uc.SetUserRole(user.Userid, role); err != nil {
+			log.Println("Error applying SSO role mapping:", err)
+		} else {
+			security.Event("oidc_role_changed", "userid", user.Userid, "from", user.Role, "to", role)
+			user.Role = role
+		}
+	}
+
+	return user, nil
+}
+
+// provisionOIDCUser creates the account of a first-time SSO user. It gets a
+// random password, which the user can replace through a password reset.
+func provisionOIDCUser(uc *repo.UserController, id *auth.IDToken, role string, mapped bool) (*models.AppUser, error) {
+	if !mapped {
+		role = defaultRole()
+	}
+	exists, err := uc.RoleExists(role)
+	if err != nil || !exists {
+		log.Println("SSO role is not defined in the roles table:", role, err)
+		return nil, errors.New("sign in is unavailable")
+	}
+
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	name := id.Name
+	if name == "" {
+		name = id.Email
+	}
+
+	user := models.AppUser{
+		Userid:    uuid.New().String(),
+		Name:      name,
+		Email:     id.Email,
+		Password:  password,
+		Role:      role,
+		Verified:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	created, err := uc.AddUser(user)
+	if err != nil {
+		log.Println("Error provisioning SSO user:", err)
+		return nil, errors.New("failed to create your account")
+	}
+
+	security.Event("oidc_user_provisioned", "userid", created.Userid, "email", created.Email, "role", role)
+	return &created, nil
+}
+
+// OIDCLogin sends the browser to the identity provider to sign in, using
+// the authorization code flow with PKCE
+func OIDCLogin(c echo.Context) error {
+	provider := oidcProvider()
+	if provider == nil {
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return err
+	}
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(oidcLogin{Nonce: nonce, Verifier: verifier})
+	if err != nil {
+		return err
+	}
+	if err := db.GetSessionStore().Set("oidc:"+state, data, oidcLoginTTL); err != nil {
+		log.Println("Error storing SSO login state:", err)
+		return oidcError(c, "Single sign-on is unavailable")
+	}
+
+	target, err := provider.AuthCodeURL(state, nonce, challenge)
+	if err != nil {
+		log.Println("Error starting SSO login:", err)
+		return oidcError(c, "Single sign-on is unavailable")
+	}
+
+	// The state is tied to this browser so a callback can't be replayed in another
+	c.SetCookie(&http.Cookie{
+		Name:     "OIDCState",
+		Value:    state,
+		Path:     "/login/oidc",
+		HttpOnly: true,
+		Secure:   middleware.SecureCookies(),
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(oidcLoginTTL),
+	})
+
+	return c.Redirect(http.StatusFound, target)
+}
+
+// OIDCCallback finishes an SSO sign-in: it redeems the code, verifies the ID
+// token and continues like a password login
+func OIDCCallback(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		provider := oidcProvider()
+		if provider == nil {
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
+
+		if errCode := c.QueryParam("error"); errCode != "" {
+			log.Println("SSO login refused by provider:", errCode, c.QueryParam("error_description"))
+			return oidcError(c, "Sign in was cancelled or refused")
+		}
+
+		state := c.QueryParam("state")
+		cookie, err := c.Cookie("OIDCState")
+		if state == "" || err != nil || cookie.Value != state {
+			return oidcError(c, "Sign in expired, please try again")
+		}
+		c.SetCookie(&http.Cookie{Name: "OIDCState", Value: "", Path: "/login/oidc", Expires: time.Unix(0, 0), HttpOnly: true, Secure: middleware.SecureCookies()})
+
+		// Each state works once
+		key := "oidc:" + state
+		data, err := db.GetSessionStore().Get(key)
+		if err != nil {
+			return oidcError(c, "Sign in expired, please try again")
+		}
+		if deleted, err := db.GetSessionStore().Delete(key); err != nil || deleted == 0 {
+			return oidcError(c, "Sign in expired, please try again")
+		}
+
+		var login oidcLogin
+		if err := json.Unmarshal(data, &login); err != nil {
+			return oidcError(c, "Sign in expired, please try again")
+		}
+
+		rawIDToken, err := provider.Exchange(c.QueryParam("code"), login.Verifier)
+		if err != nil {
+			log.Println("Error redeeming SSO code:", err)
+			return oidcError(c, "Sign in failed")
+		}
+
+		id, err := provider.VerifyIDToken(rawIDToken, login.Nonce, oidcGroupsClaim())
+		if err != nil {
+			security.Event("oidc_invalid_id_token", "ip", c.RealIP(), "error", err.Error())
+			return oidcError(c, "Sign in failed")
+		}
+
+		user, err := oidcUser(uc, id)
+		if err != nil {
+			return oidcError(c, err.Error())
+		}
+
+		// Two-factor authentication applies to SSO logins too
+		return beginLogin(c, uc, user)
+	}
+}
+
+// oidcError returns to the login page with the error
+func oidcError(c echo.Context, message string) error {
+	return c.Redirect(http.StatusSeeOther, "/login?error="+url.QueryEscape(message))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"rethink/api/db"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// startOIDC points SSO at a mock provider whose token endpoint refuses every
+// code, which is as far as these tests need a callback to get
+func startOIDC(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	// The provider is configured on first use, once per process
+	viper.Set("OIDC_ISSUER", server.URL)
+	viper.Set("OIDC_CLIENT_ID", "library")
+	if p := oidcProvider(); p == nil || p.Issuer != server.URL {
+		t.Skip("SSO was already configured with another provider")
+	}
+
+	db.SetSessionStore(db.NewMemoryStore(time.Minute))
+}
+
+// oidcLoginState starts a sign-in and returns its state
+func oidcLoginState(t *testing.T, e *echo.Echo) string {
+	rec := httptest.NewRecorder()
+	if err := OIDCLogin(e.NewContext(httptest.NewRequest(http.MethodGet, "/login/oidc", nil), rec)); err != nil {
+		t.Fatal(err)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+	if state == "" {
+		t.Fatalf("no state in the redirect to %s", location)
+	}
+	return state
+}
+
+// oidcCallback calls the callback with the state in the query and cookie
+// and returns the error shown on the login page
+func oidcCallback(t *testing.T, e *echo.Echo, queryState, cookieState string) string {
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?code=abc&state="+url.QueryEscape(queryState), nil)
+	if cookieState != "" {
+		req.AddCookie(&http.Cookie{Name: "OIDCState", Value: cookieState})
+	}
+	rec := httptest.NewRecorder()
+
+	if err := OIDCCallback(nil)(e.NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.Path, "/login") {
+		t.Fatalf("callback redirected to %q, want the login page", rec.Header().Get("Location"))
+	}
+	return location.Query().Get("error")
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	startOIDC(t)
+	e := echo.New()
+	const expired = "Sign in expired, please try again"
+
+	state := oidcLoginState(t, e)
+	if got := oidcCallback(t, e, state, ""); got != expired {
+		t.Errorf("without the state cookie: error = %q, want %q", got, expired)
+	}
+	if got := oidcCallback(t, e, state, "another-state"); got != expired {
+		t.Errorf("with another browser's state: error = %q, want %q", got, expired)
+	}
+	if got := oidcCallback(t, e, "unknown", "unknown"); got != expired {
+		t.Errorf("with an unknown state: error = %q, want %q", got, expired)
+	}
+
+	// A valid state gets as far as redeeming the code, and only once
+	if got := oidcCallback(t, e, state, state); got != "Sign in failed" {
+		t.Errorf("with the valid state: error = %q, want the code to be refused", got)
+	}
+	if got := oidcCallback(t, e, state, state); got != expired {
+		t.Errorf("with a used state: error = %q, want %q", got, expired)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"rethink/api/db"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentpassword" form:"currentpassword"`
+	Password        string `json:"password" form:"password"`
+	Confirm         string `json:"confirm" form:"confirm"`
+}
+
+// errPasswordPolicy is returned when the new password breaks the policy
+var errPasswordPolicy = errors.New("password does not meet the requirements")
+
+// changePassword re-authenticates the logged in user with their current
+// password, stores the new one, ends every session and API token of the user
+// and issues a fresh token for this device. Wrong current passwords count
+// towards the login throttle like failed logins.
+func changePassword(c echo.Context, uc *repo.UserController, req *ChangePasswordRequest) (*TokenPair, []string, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, nil, errors.New("unauthorized")
+	}
+
+	user, err := uc.GetUserByUserid(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ip := c.RealIP()
+	if _, blocked := loginBlocked(user.Email, ip); blocked {
+		return nil, nil, errors.New("too many failed attempts, please try again later")
+	}
+	if !db.CheckHashedPassword(req.CurrentPassword, user.Password) {
+		recordLoginFailure(user.Email, ip)
+		return nil, nil, errors.New("current password is incorrect")
+	}
+	if err := clearLoginFailures(user.Email); err != nil {
+		log.Println("Error clearing failed logins:", err)
+	}
+	if req.Password != req.Confirm {
+		return nil, nil, errors.New("passwords do not match")
+	}
+	if req.Password == req.CurrentPassword {
+		return nil, nil, errors.New("new password must be different from the current one")
+	}
+	if problems := db.ValidatePassword(req.Password, user.Email, user.Name); len(problems) > 0 {
+		return nil, problems, errPasswordPolicy
+	}
+
+	if err := uc.SetPassword(userID, req.Password); err != nil {
+		log.Println("Error changing password:", err)
+		return nil, nil, errors.New("failed to change password")
+	}
+
+	if err := revokeSessions(userID); err != nil {
+		log.Println("Error revoking sessions after password change:", err)
+		return nil, nil, errors.New("password changed, please log in again")
+	}
+	if err := revokeAPITokens(userID); err != nil {
+		log.Println("Error revoking API tokens after password change:", err)
+	}
+
+	pair, err := newSessionToken(c, user)
+	if err != nil {
+		return nil, nil, errors.New("password changed, please log in again")
+	}
+
+	setAuthCookies(c, pair)
+	return pair, nil, nil
+}
+
+// ChangePassword changes the logged in user's password and returns new tokens
+func ChangePassword(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(ChangePasswordRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+
+		pair, problems, err := changePassword(c, uc, req)
+		if err == errPasswordPolicy {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error(), "problems": problems})
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, pair)
+	}
+}
+
+// PostChangePassword handles the change password form
+func PostChangePassword(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := &ChangePasswordRequest{
+			CurrentPassword: c.FormValue("currentpassword"),
+			Password:        c.FormValue("password"),
+			Confirm:         c.FormValue("confirm"),
+		}
+
+		data := map[string]interface{}{
+			"Title": "Change Password",
+		}
+
+		_, problems, err := changePassword(c, uc, req)
+		if err != nil {
+			data["Error"] = err.Error()
+			data["PasswordErrors"] = problems
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		data["Message"] = "Password changed. Your other sessions have been logged out and your API tokens revoked."
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"rethink/api/middleware"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ListRequest struct {
+	Name   string `json:"name" form:"name"`
+	Shared *bool  `json:"shared" form:"shared"`
+}
+
+type ListBookRequest struct {
+	BookID int `json:"bookid" form:"bookid"`
+}
+
+type ListOrderRequest struct {
+	BookIDs []int `json:"bookids" form:"bookids"`
+}
+
+// ListWithBooks is a reading list together with the details of its books
+type ListWithBooks struct {
+	models.ReadingList
+	Books []models.Books `json:"books"`
+}
+
+// currentUserID returns the authenticated user's ID
+func currentUserID(c echo.Context) (string, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return "", false
+	}
+	return principal.Userid, true
+}
+
+// withBooks attaches the book details to each reading list
+func withBooks(lc *repo.ListController, lists []models.ReadingList) ([]ListWithBooks, error) {
+	result := make([]ListWithBooks, 0, len(lists))
+	for i := range lists {
+		books, err := lc.GetListBooks(&lists[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ListWithBooks{ReadingList: lists[i], Books: books})
+	}
+	return result, nil
+}
+
+// GetLists retrieves the authenticated user's reading lists
+func GetLists(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		lists, err := lc.GetLists(userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, lists)
+	}
+}
+
+// GetList retrieves one of the authenticated user's reading lists with its books
+func GetList(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		list, err := lc.GetUserList(c.Param("id"), userID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		books, err := lc.GetListBooks(list)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, ListWithBooks{ReadingList: *list, Books: books})
+	}
+}
+
+// CreateList creates a new reading list for the authenticated user
+func CreateList(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		req := new(ListRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid list data"})
+		}
+
+		list, err := lc.CreateList(userID, req.Name)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		if req.Shared != nil && *req.Shared {
+			list, err = lc.SetShared(list.ID, true)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+		}
+
+		return c.JSON(http.StatusCreated, list)
+	}
+}
+
+// UpdateList renames a reading list and/or changes whether it is shared
+func UpdateList(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		list, err := lc.GetUserList(c.Param("id"), userID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		req := new(ListRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid list data"})
+		}
+
+		if req.Name != "" {
+			if err := lc.RenameList(list.ID, req.Name); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+		}
+
+		if req.Shared != nil && *req.Shared != list.Shared {
+			if _, err := lc.SetShared(list.ID, *req.Shared); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+		}
+
+		list, err = lc.GetList(list.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, list)
+	}
+}
+
+// DeleteList removes one of the authenticated user's reading lists
+func DeleteList(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		list, err := lc.GetUserList(c.Param("id"), userID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		if err := lc.DeleteList(list.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// AddListBook adds a book to one of the authenticated user's reading lists
+func AddListBook(lc *repo.ListController, bc *repo.BookController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		list, err := lc.GetUserList(c.Param("id"), userID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		req := new(ListBookRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid book ID"})
+		}
+
+		if _, err := bc.GetBook(req.BookID); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "book not found"})
+		}
+
+		if err := lc.AddBook(list.ID, req.BookID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "book added to list"})
+	}
+}
+
+// RemoveListBook takes a book off one of the authenticated user's reading lists
+func RemoveListBook(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		list, err := lc.GetUserList(c.Param("id"), userID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		BookID, err := strconv.Atoi(c.Param("bookid"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid book ID"})
+		}
+
+		if err := lc.RemoveBook(list.ID, BookID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// ReorderList sets the order of the books on one of the authenticated user's reading lists
+func ReorderList(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		list, err := lc.GetUserList(c.Param("id"), userID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		req := new(ListOrderRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid book order"})
+		}
+
+		if err := lc.ReorderBooks(list.ID, req.BookIDs); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "list reordered"})
+	}
+}
+
+// GetSharedList retrieves a shared reading list by its link token, no login needed
+func GetSharedList(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := lc.GetSharedList(c.Param("token"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		books, err := lc.GetListBooks(list)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		// The owner and share token are not exposed to link holders
+		return c.JSON(http.StatusOK, list.PublicView(books))
+	}
+}
+
+// UserListsPage renders the reading lists management page
+func UserListsPage(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title":   "My Reading Lists",
+			"Message": c.QueryParam("message"),
+			"Error":   c.QueryParam("error"),
+		}
+
+		userID, ok := currentUserID(c)
+		if !ok {
+			data["Error"] = "Unauthorized"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		lists, err := lc.GetLists(userID)
+		if err == nil {
+			data["Lists"], err = withBooks(lc, lists)
+		}
+		if err != nil {
+			data["Error"] = "Failed to retrieve reading lists"
+		}
+
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
+
+// PostListAction handles the forms on the reading lists page
+func PostListAction(lc *repo.ListController, bc *repo.BookController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		action := c.Param("action")
+		BookID, _ := strconv.Atoi(c.FormValue("bookId"))
+
+		var list *models.ReadingList
+		var err error
+		if action != "create" {
+			list, err = lc.GetUserList(c.FormValue("listId"), userID)
+			if err != nil {
+				return c.Redirect(http.StatusSeeOther, "/user/lists?error=Reading+list+not+found")
+			}
+		}
+
+		switch action {
+		case "create":
+			_, err = lc.CreateList(userID, c.FormValue("name"))
+		case "rename":
+			err = lc.RenameList(list.ID, c.FormValue("name"))
+		case "share":
+			_, err = lc.SetShared(list.ID, c.FormValue("shared") == "true")
+		case "add":
+			if _, err = bc.GetBook(BookID); err == nil {
+				err = lc.AddBook(list.ID, BookID)
+			}
+		case "remove":
+			err = lc.RemoveBook(list.ID, BookID)
+		case "up":
+			err = lc.MoveBook(list.ID, BookID, -1)
+		case "down":
+			err = lc.MoveBook(list.ID, BookID, 1)
+		case "delete":
+			err = lc.DeleteList(list.ID)
+		default:
+			return c.Redirect(http.StatusSeeOther, "/user/lists?error=Unknown+action")
+		}
+
+		if err != nil {
+			return c.Redirect(http.StatusSeeOther, "/user/lists?error="+url.QueryEscape(err.Error()))
+		}
+
+		return c.Redirect(http.StatusSeeOther, "/user/lists")
+	}
+}
+
+// SharedListPage renders a shared reading list for anyone holding the link
+func SharedListPage(lc *repo.ListController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title": "Shared Reading List",
+		}
+
+		list, err := lc.GetSharedList(c.Param("token"))
+		if err != nil {
+			data["Error"] = "This list does not exist or is no longer shared"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		books, err := lc.GetListBooks(list)
+		if err != nil {
+			data["Error"] = "Failed to retrieve books"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		data["Title"] = list.Name
+		data["Books"] = books
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"rethink/api/db"
+	"rethink/api/mail"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// resetTTL is how long a password reset link stays valid
+const resetTTL = time.Hour
+
+// resetKey is the session store key of a reset token. Only the token's hash
+// is stored so a leaked store can't be used to reset passwords.
+func resetKey(token string) string {
+	return "reset:" + hashToken(token)
+}
+
+// issueResetToken creates a random reset token for a user
+func issueResetToken(userID string) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.GetSessionStore().Set(resetKey(token), []byte(userID), resetTTL); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// resetTokenUser returns the user a reset token was issued for
+func resetTokenUser(token string) (string, error) {
+	userID, err := db.GetSessionStore().Get(resetKey(token))
+	if err != nil || len(userID) == 0 {
+		return "", errors.New("invalid or expired reset link")
+	}
+	return string(userID), nil
+}
+
+// consumeResetToken returns the user a reset token was issued for and
+// invalidates it, so each token works only once
+func consumeResetToken(token string) (string, error) {
+	userID, err := resetTokenUser(token)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the request that actually deletes the key may use the token
+	deleted, err := db.GetSessionStore().Delete(resetKey(token))
+	if err != nil || deleted == 0 {
+		return "", errors.New("invalid or expired reset link")
+	}
+
+	return userID, nil
+}
+
+// sendResetEmail mails the user a link to reset their password
+func sendResetEmail(user *models.AppUser) error {
+	token, err := issueResetToken(user.Userid)
+	if err != nil {
+		return err
+	}
+
+	link := appURL() + "/password/reset?token=" + url.QueryEscape(token)
+	return mail.GetMailer().Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nA password reset was requested for your account. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %d minutes and can be used once. If you didn't ask for this, you can ignore this email.",
+			user.Name, link, int(resetTTL.Minutes())),
+	})
+}
+
+// ForgotPassword sends a reset link. The response is the same whether or not
+// the address belongs to an account.
+func ForgotPassword(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email := c.FormValue("email")
+
+		user, err := uc.GetUserByEmail(email)
+		if err == nil && !user.Disabled {
+			if err := sendResetEmail(user); err != nil {
+				log.Println("Error sending password reset email:", err)
+			}
+		}
+
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title":   "Forgot Password",
+			"Message": "If that address belongs to an account, a password reset link is on its way.",
+		})
+	}
+}
+
+// ResetPasswordPage renders the new password form for a reset link
+func ResetPasswordPage(c echo.Context) error {
+	return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+		"Title": "Reset Password",
+		"Token": c.QueryParam("token"),
+	})
+}
+
+// ResetPassword sets a new password from a reset link and ends every session
+// of the user
+func ResetPassword(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.FormValue("token")
+		password := c.FormValue("password")
+
+		data := map[string]interface{}{
+			"Title": "Reset Password",
+			"Token": token,
+		}
+
+		var user *models.AppUser
+		userID, err := resetTokenUser(token)
+		if err == nil {
+			user, err = uc.GetUserByUserid(userID)
+		}
+		// Links sent before the account was disabled no longer work
+		if err != nil || user.Disabled {
+			data["Token"] = ""
+			data["Error"] = "invalid or expired reset link"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		// Check the new password before spending the token on it
+		if password != c.FormValue("confirm") {
+			data["Error"] = "Passwords do not match"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+		if problems := db.ValidatePassword(password, user.Email, user.Name); len(problems) > 0 {
+			data["Error"] = "Password does not meet the requirements"
+			data["PasswordErrors"] = problems
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		if _, err := consumeResetToken(token); err != nil {
+			data["Token"] = ""
+			data["Error"] = err.Error()
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		if err := uc.SetPassword(userID, password); err != nil {
+			log.Println("Error resetting password:", err)
+			data["Token"] = ""
+			data["Error"] = "Failed to reset password, please request a new link"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		if err := revokeSessions(userID); err != nil {
+			log.Println("Error revoking sessions after password reset:", err)
+		}
+		if err := revokeAPITokens(userID); err != nil {
+			log.Println("Error revoking API tokens after password reset:", err)
+		}
+		if err := uc.SetUserActive(userID, false); err != nil {
+			log.Println("Error updating active status after password reset:", err)
+		}
+
+		data["Token"] = ""
+		data["Message"] = "Your password has been reset. You can now log in."
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rethink/api/middleware"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReviewRequest struct {
+	Rating int    `json:"rating" form:"rating"`
+	Text   string `json:"text" form:"text"`
+}
+
+type HideReviewRequest struct {
+	Hidden bool `json:"hidden" form:"hidden"`
+}
+
+// canModerate reports whether the authenticated user may see and hide reviews
+func canModerate(c echo.Context, uc *repo.UserController) bool {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return false
+	}
+	if principal.ViaAPIToken() && !principal.HasScope("review_moderate") {
+		return false
+	}
+
+	role, err := uc.GetUserRoleByEmail(principal.Email)
+	if err != nil {
+		return false
+	}
+
+	allowed, err := uc.HasPermission(role, "review_moderate")
+	return err == nil && allowed
+}
+
+// GetReviews lists the reviews of a book. Moderators also get hidden reviews.
+func GetReviews(rc *repo.ReviewController, uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		BookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid book ID"})
+		}
+
+		reviews, err := rc.GetReviews(BookID, canModerate(c, uc))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, reviews)
+	}
+}
+
+// SaveReview creates or edits the authenticated user's review of a book
+func SaveReview(rc *repo.ReviewController, bc *repo.BookController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		// Retrieve user from context
+		userID, exists := currentUserID(c)
+		if !exists {
+			fmt.Println("Error: User context is missing")
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		BookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid book ID"})
+		}
+
+		req := new(ReviewRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid review data"})
+		}
+
+		// Reviews can only be left on books that exist
+		if _, err := bc.GetBook(BookID); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "book not found"})
+		}
+
+		review, err := rc.SaveReview(models.Review{
+			BookID: BookID,
+			Userid: userID,
+			Rating: req.Rating,
+			Text:   req.Text,
+		})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, review)
+	}
+}
+
+// HideReview hides or restores an abusive review
+func HideReview(rc *repo.ReviewController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		req := new(HideReviewRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+
+		if err := rc.SetHidden(c.Param("id"), req.Hidden); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": c.Param("id"), "hidden": req.Hidden})
+	}
+}
+
+// PostReview handles the review form on the book details page
+func PostReview(rc *repo.ReviewController, bc *repo.BookController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		userID, exists := currentUserID(c)
+		if !exists {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		BookID, err := strconv.Atoi(c.FormValue("bookId"))
+		if err != nil {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Review Book",
+				"Error": "Invalid book ID",
+			})
+		}
+
+		if _, err := bc.GetBook(BookID); err != nil {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Review Book",
+				"Error": "Book not found",
+			})
+		}
+
+		rating, _ := strconv.Atoi(c.FormValue("rating"))
+		_, err = rc.SaveReview(models.Review{
+			BookID: BookID,
+			Userid: userID,
+			Rating: rating,
+			Text:   c.FormValue("text"),
+		})
+		if err != nil {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Review Book",
+				"Error": err.Error(),
+			})
+		}
+
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/books/id?id=%d", BookID))
+	}
+}
+
+// PostHideReview handles the moderator's hide/restore form on the book details page
+func PostHideReview(rc *repo.ReviewController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		ID := c.FormValue("reviewId")
+		hidden := c.FormValue("hidden") == "true"
+
+		review, err := rc.GetReview(ID)
+		if err != nil {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Moderate Review",
+				"Error": "Review not found",
+			})
+		}
+
+		if err := rc.SetHidden(ID, hidden); err != nil {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Moderate Review",
+				"Error": err.Error(),
+			})
+		}
+
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/books/id?id=%d", review.BookID))
+	}
+}
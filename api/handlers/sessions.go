@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"rethink/api/db"
+	"rethink/api/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SessionView is a session marked with whether it is the one making the request
+type SessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// userSessionViews lists the logged in user's sessions
+func userSessionViews(c echo.Context) ([]SessionView, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	sessions, err := db.ListSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := currentSessionID(c)
+	views := make([]SessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, SessionView{Session: session, Current: session.ID == current})
+	}
+	return views, nil
+}
+
+// revokeSession ends one of the logged in user's sessions
+func revokeSession(c echo.Context, id string) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return fmt.Errorf("unauthorized")
+	}
+	return db.DeleteSession(userID, id)
+}
+
+// revokeOtherSessions ends every session of the logged in user but this one
+func revokeOtherSessions(c echo.Context) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return fmt.Errorf("unauthorized")
+	}
+	return db.DeleteUserSessions(userID, currentSessionID(c))
+}
+
+// ListSessions lists the logged in user's sessions
+func ListSessions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sessions, err := userSessionViews(c)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// RevokeSession ends one of the logged in user's sessions
+func RevokeSession() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := revokeSession(c, c.Param("id")); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// RevokeOtherSessions ends every session of the logged in user but the current one
+func RevokeOtherSessions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := revokeOtherSessions(c); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// SessionsPage renders the logged in user's sessions
+func SessionsPage(c echo.Context) error {
+	data := map[string]interface{}{
+		"Title":   "My Sessions",
+		"Message": c.QueryParam("message"),
+		"Error":   c.QueryParam("error"),
+	}
+
+	sessions, err := userSessionViews(c)
+	if err != nil {
+		data["Error"] = "Failed to retrieve sessions"
+	}
+	data["Sessions"] = sessions
+
+	return c.Render(http.StatusOK, "layout.html", data)
+}
+
+// PostSessionAction handles the forms on the sessions page
+func PostSessionAction(c echo.Context) error {
+	var err error
+	var message string
+	switch c.Param("action") {
+	case "revoke":
+		err = revokeSession(c, c.FormValue("sessionId"))
+		message = "Session logged out"
+	case "revoke-others":
+		err = revokeOtherSessions(c)
+		message = "All other sessions logged out"
+	default:
+		err = fmt.Errorf("unknown action")
+	}
+
+	if err != nil {
+		return c.Redirect(http.StatusSeeOther, "/user/sessions?error="+url.QueryEscape(err.Error()))
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/user/sessions?message="+url.QueryEscape(message))
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// parseStatsRange reads the optional "from" and "to" dates (YYYY-MM-DD). Both
+// days are inclusive, so "to" is moved to the start of the following day.
+func parseStatsRange(c echo.Context) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	if v := c.QueryParam("from"); v != "" {
+		from, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return from, to, err
+		}
+	}
+
+	if v := c.QueryParam("to"); v != "" {
+		to, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return from, to, err
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	return from, to, nil
+}
+
+// csvCell keeps user text from being read as a formula when the file is
+// opened in a spreadsheet, by prefixing it with a quote
+func csvCell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
+
+// statsCSV flattens the report into metric,key,value rows
+func statsCSV(stats *models.Stats) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	rows := [][]string{
+		{"metric", "key", "value"},
+		{"total_books", "", strconv.Itoa(stats.TotalBooks)},
+	}
+	for _, m := range stats.BooksPerMonth {
+		rows = append(rows, []string{"books_per_month", m.Month, strconv.Itoa(m.Count)})
+	}
+	for _, u := range stats.TopContributors {
+		rows = append(rows, []string{"top_contributor", csvCell(u.Userid + " " + u.Name), strconv.Itoa(u.Count)})
+	}
+	for _, role := range stats.UsersByRole {
+		rows = append(rows, []string{"users_by_role", csvCell(role.Role), strconv.Itoa(role.Count)})
+	}
+	rows = append(rows,
+		[]string{"users_by_status", "active", strconv.Itoa(stats.ActiveUsers)},
+		[]string{"users_by_status", "inactive", strconv.Itoa(stats.InactiveUsers)},
+	)
+	for _, book := range stats.RecentlyUpdated {
+		rows = append(rows, []string{"recently_updated", csvCell(strconv.Itoa(book.BookID) + " " + book.Title), book.UpdatedAt.Format(time.RFC3339)})
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetStats returns the catalog report as JSON, or as CSV with ?format=csv
+func GetStats(sc *repo.StatsController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		from, to, err := parseStatsRange(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid date format. Use YYYY-MM-DD"})
+		}
+
+		stats, err := sc.GetStats(from, to)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to compute stats"})
+		}
+
+		if c.QueryParam("format") != "csv" {
+			return c.JSON(http.StatusOK, stats)
+		}
+
+		data, err := statsCSV(stats)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to export stats"})
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="stats.csv"`)
+		return c.Blob(http.StatusOK, "text/csv", data)
+	}
+}
+
+// StatsPage renders the catalog report
+func StatsPage(sc *repo.StatsController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title": "Catalog Statistics",
+			"From":  c.QueryParam("from"),
+			"To":    c.QueryParam("to"),
+		}
+
+		from, to, err := parseStatsRange(c)
+		if err != nil {
+			data["Error"] = "Invalid date format. Use YYYY-MM-DD"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		stats, err := sc.GetStats(from, to)
+		if err != nil {
+			data["Error"] = "Failed to compute stats"
+			return c.Render(http.StatusOK, "layout.html", data)
+		}
+
+		data["Stats"] = stats
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"rethink/api/db"
+	"rethink/api/security"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// failureWindow is how long failed logins are remembered
+	failureWindow = 15 * time.Minute
+	// freeAttempts is the number of failures allowed before backoff starts
+	freeAttempts = 3
+	// maxBackoff caps the wait between attempts
+	maxBackoff = 5 * time.Minute
+	// accountLockAfter failures lock the account for accountLockDuration
+	accountLockAfter    = 10
+	accountLockDuration = 30 * time.Minute
+	// ipLockAfter failures from one address lock it for ipLockDuration
+	ipLockAfter    = 50
+	ipLockDuration = time.Hour
+)
+
+// Login throttling keys. Accounts are keyed by the normalized email that was
+// typed, so unknown addresses are throttled exactly like real ones.
+func accountKey(kind, email string) string {
+	return "login:" + kind + ":account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(kind, ip string) string {
+	return "login:" + kind + ":ip:" + ip
+}
+
+// loginBlocked reports whether login attempts for the email or from the IP
+// are currently refused and for how long
+func loginBlocked(email, ip string) (time.Duration, bool) {
+	store := db.GetSessionStore()
+
+	var wait time.Duration
+	for _, key := range []string{
+		accountKey("lock", email), ipKey("lock", ip),
+		accountKey("next", email), ipKey("next", ip),
+	} {
+		ttl, err := store.TTL(key)
+		if err != nil {
+			log.Println("Error checking login throttle:", err)
+			continue
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+
+	return wait, wait > 0
+}
+
+// backoff is the wait imposed after the given number of failures
+func backoff(failures int64) time.Duration {
+	if failures <= freeAttempts {
+		return 0
+	}
+	wait := time.Duration(math.Pow(2, float64(failures-freeAttempts))) * time.Second
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// recordFailure counts a failed login under the given keys and applies the
+// backoff and lockout. It returns the failure count and whether this failure
+// triggered the lockout.
+func recordFailure(failKey, nextKey, lockKey string, lockAfter int64, lockDuration time.Duration) (int64, bool) {
+	store := db.GetSessionStore()
+
+	failures, err := store.Incr(failKey, failureWindow)
+	if err != nil {
+		log.Println("Error recording failed login:", err)
+		return 0, false
+	}
+	count := []byte(strconv.FormatInt(failures, 10))
+
+	if failures >= lockAfter {
+		store.Set(lockKey, count, lockDuration)
+		return failures, failures == lockAfter
+	}
+
+	if wait := backoff(failures); wait > 0 {
+		store.Set(nextKey, count, wait)
+	}
+
+	return failures, false
+}
+
+// recordLoginFailure counts a failed login for both the email and the IP and
+// writes lockouts to the security log
+func recordLoginFailure(email, ip string) {
+	if failures, locked := recordFailure(accountKey("fail", email), accountKey("next", email), accountKey("lock", email),
+		accountLockAfter, accountLockDuration); locked {
+		security.Event("account_locked", "email", email, "ip", ip, "failures", strconv.FormatInt(failures, 10))
+	}
+
+	if failures, locked := recordFailure(ipKey("fail", ip), ipKey("next", ip), ipKey("lock", ip),
+		ipLockAfter, ipLockDuration); locked {
+		security.Event("ip_locked", "ip", ip, "failures", strconv.FormatInt(failures, 10))
+	}
+}
+
+// clearLoginFailures resets the counters, backoff and lockout of an account
+func clearLoginFailures(email string) error {
+	_, err := db.GetSessionStore().Delete(
+		accountKey("fail", email), accountKey("next", email), accountKey("lock", email),
+	)
+	return err
+}
+
+// accountLocked reports whether an account is locked out after failed logins
+func accountLocked(email string) bool {
+	ttl, err := db.GetSessionStore().TTL(accountKey("lock", email))
+	return err == nil && ttl > 0
+}
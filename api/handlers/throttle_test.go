@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"rethink/api/db"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{1, 0},
+		{freeAttempts, 0},
+		{freeAttempts + 1, 2 * time.Second},
+		{freeAttempts + 2, 4 * time.Second},
+		{freeAttempts + 20, maxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	db.SetSessionStore(db.NewMemoryStore(time.Minute))
+
+	const ip = "192.0.2.1"
+	for i := 0; i < freeAttempts; i++ {
+		recordLoginFailure("Reader@Example.com", ip)
+	}
+	if wait, blocked := loginBlocked("reader@example.com", ip); blocked {
+		t.Fatalf("blocked for %v within the free attempts", wait)
+	}
+
+	// Emails are throttled however they are typed
+	recordLoginFailure(" reader@example.com ", ip)
+	wait, blocked := loginBlocked("READER@example.com", "192.0.2.2")
+	if !blocked || wait <= 0 || wait > 2*time.Second {
+		t.Errorf("after %d failures: wait %v, blocked %v, want about 2s", freeAttempts+1, wait, blocked)
+	}
+	if _, blocked := loginBlocked("other@example.com", "192.0.2.2"); blocked {
+		t.Error("another account was throttled")
+	}
+
+	for i := freeAttempts + 1; i < accountLockAfter; i++ {
+		recordLoginFailure("reader@example.com", ip)
+	}
+	if !accountLocked("reader@example.com") {
+		t.Errorf("account not locked after %d failures", accountLockAfter)
+	}
+	if wait, _ := loginBlocked("reader@example.com", "192.0.2.2"); wait < accountLockDuration-time.Minute {
+		t.Errorf("locked account wait = %v, want about %v", wait, accountLockDuration)
+	}
+
+	if err := clearLoginFailures("reader@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if accountLocked("reader@example.com") {
+		t.Error("account still locked after clearing its failures")
+	}
+	if wait, blocked := loginBlocked("reader@example.com", "192.0.2.2"); blocked {
+		t.Errorf("still blocked for %v after clearing failures", wait)
+	}
+}
+
+func TestLoginThrottleLocksAddress(t *testing.T) {
+	db.SetSessionStore(db.NewMemoryStore(time.Minute))
+
+	// Spread over many accounts so only the address is locked
+	const ip = "192.0.2.1"
+	for i := 0; i < ipLockAfter; i++ {
+		recordLoginFailure(string(rune('a'+i%26))+"@example.com", ip)
+	}
+
+	if wait, blocked := loginBlocked("new@example.com", ip); !blocked || wait < ipLockDuration-time.Minute {
+		t.Errorf("address wait = %v, blocked %v, want about %v", wait, blocked, ipLockDuration)
+	}
+	if _, blocked := loginBlocked("new@example.com", "192.0.2.2"); blocked {
+		t.Error("another address was throttled")
+	}
+}
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"rethink/api/auth"
+	"rethink/api/db"
+	"rethink/api/middleware"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"rethink/api/security"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// mfaChallengeTTL is how long a user has to enter their code after their password
+const mfaChallengeTTL = 5 * time.Minute
+
+// Wrong codes are counted per user; too many block the second step for a while
+const (
+	maxSecondFactorFailures = 5
+	secondFactorLockout     = 15 * time.Minute
+)
+
+type TwoFactorRequest struct {
+	Code         string `json:"code" form:"code"`
+	RecoveryCode string `json:"recoverycode" form:"recoverycode"`
+}
+
+// totpRequired reports whether the user's role must use two-factor
+// authentication, as listed in TOTP_REQUIRED_ROLES
+func totpRequired(user *models.AppUser) bool {
+	return contains(viper.GetStringSlice("TOTP_REQUIRED_ROLES"), user.Role)
+}
+
+// hashRecoveryCodes is how a new set of recovery codes is stored
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return hashes
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. Accepted codes can't be used again.
+func checkSecondFactor(uc *repo.UserController, user *models.AppUser, req *TwoFactorRequest) error {
+	failKey := "mfa:fail:" + user.Userid
+	store := db.GetSessionStore()
+	data, _ := store.Get(failKey)
+	if failures, _ := strconv.Atoi(string(data)); failures >= maxSecondFactorFailures {
+		return errors.New("too many wrong codes, please try again later")
+	}
+
+	var err error
+	if req.RecoveryCode != "" {
+		err = uc.UseRecoveryCode(user.Userid, auth.HashRecoveryCode(req.RecoveryCode))
+	} else {
+		err = checkTOTPCode(uc, user, req.Code)
+	}
+
+	if err != nil {
+		failures, _ := store.Incr(failKey, secondFactorLockout)
+		if failures == maxSecondFactorFailures {
+			security.Event("second_factor_locked", "userid", user.Userid)
+		}
+		return errors.New("invalid code")
+	}
+
+	store.Delete(failKey)
+	return nil
+}
+
+// checkTOTPCode checks a code against the user's secret and spends its time step
+func checkTOTPCode(uc *repo.UserController, user *models.AppUser, code string) error {
+	secret, err := auth.DecryptTOTPSecret(user.TOTPSecret)
+	if err != nil {
+		log.Println("Error decrypting TOTP secret:", err)
+		return err
+	}
+
+	step, ok := auth.CheckTOTP(secret, code, user.TOTPLastStep)
+	if !ok {
+		return errors.New("invalid code")
+	}
+	if err := uc.UseTOTPStep(user.Userid, step); err != nil {
+		return err
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// setupTOTP gives the user a secret to add to their authenticator app. It
+// only takes effect once confirmed with enableTOTP; until then the same
+// pending secret is shown again, so a reload doesn't invalidate the one
+// already scanned.
+func setupTOTP(uc *repo.UserController, user *models.AppUser) (secret, uri string, err error) {
+	if user.TOTPEnabled {
+		return "", "", errors.New("two-factor authentication is already on")
+	}
+
+	if user.TOTPSecret != "" {
+		if secret, err := auth.DecryptTOTPSecret(user.TOTPSecret); err == nil {
+			return secret, auth.TOTPURI(user.Email, secret), nil
+		}
+	}
+
+	secret, err = auth.NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := auth.EncryptTOTPSecret(secret)
+	if err != nil {
+		log.Println("Error encrypting TOTP secret:", err)
+		return "", "", errors.New("failed to set up two-factor authentication")
+	}
+	if err := uc.SetTOTPSecret(user.Userid, sealed); err != nil {
+		return "", "", err
+	}
+
+	return secret, auth.TOTPURI(user.Email, secret), nil
+}
+
+// enableTOTP turns on two-factor authentication once the user proves their
+// app generates codes, and returns their recovery codes
+func enableTOTP(uc *repo.UserController, user *models.AppUser, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, errors.New("two-factor authentication is already on")
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.New("set up two-factor authentication first")
+	}
+
+	secret, err := auth.DecryptTOTPSecret(user.TOTPSecret)
+	if err != nil {
+		return nil, errors.New("set up two-factor authentication again")
+	}
+	step, ok := auth.CheckTOTP(secret, code, 0)
+	if !ok {
+		return nil, errors.New("invalid code")
+	}
+
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.EnableTOTP(user.Userid, step, hashRecoveryCodes(codes)); err != nil {
+		return nil, err
+	}
+
+	security.Event("totp_enabled", "userid", user.Userid)
+	return codes, nil
+}
+
+// disableTOTP turns off two-factor authentication after checking a code or
+// recovery code. It doesn't ask for the password, which SSO users never see.
+// Roles that require it can't turn it off.
+func disableTOTP(uc *repo.UserController, user *models.AppUser, req *TwoFactorRequest) error {
+	if !user.TOTPEnabled {
+		return errors.New("two-factor authentication is not on")
+	}
+	if totpRequired(user) {
+		return errors.New("your role requires two-factor authentication")
+	}
+	if err := checkSecondFactor(uc, user, req); err != nil {
+		return err
+	}
+
+	if err := uc.DisableTOTP(user.Userid); err != nil {
+		return err
+	}
+	security.Event("totp_disabled", "userid", user.Userid)
+	return nil
+}
+
+// regenerateRecoveryCodes replaces the user's recovery codes after checking a code
+func regenerateRecoveryCodes(uc *repo.UserController, user *models.AppUser, req *TwoFactorRequest) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, errors.New("two-factor authentication is not on")
+	}
+	if err := checkSecondFactor(uc, user, req); err != nil {
+		return nil, err
+	}
+
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.SetRecoveryCodes(user.Userid, hashRecoveryCodes(codes)); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// currentUser loads the logged in user
+func currentUser(c echo.Context, uc *repo.UserController) (*models.AppUser, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, errors.New("unauthorized")
+	}
+	return uc.GetUserByUserid(userID)
+}
+
+// beginLogin is called once a user has proven their password or signed in
+// through SSO. Users with two-factor authentication, or whose role requires
+// it, are sent to the second step; everyone else is logged in.
+func beginLogin(c echo.Context, uc *repo.UserController, user *models.AppUser) error {
+	if !user.TOTPEnabled && !totpRequired(user) {
+		if err := completeLogin(c, uc, user); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.Redirect(http.StatusSeeOther, "/boks")
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	if err := db.GetSessionStore().Set("mfa:"+hashToken(token), []byte(user.Userid), mfaChallengeTTL); err != nil {
+		log.Println("Error storing login challenge:", err)
+		return c.Redirect(http.StatusSeeOther, "/login?error="+url.QueryEscape("Login is unavailable"))
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     "MFA",
+		Value:    token,
+		Path:     "/login/2fa",
+		HttpOnly: true,
+		Secure:   middleware.SecureCookies(),
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(mfaChallengeTTL),
+	})
+
+	if !user.TOTPEnabled {
+		return c.Redirect(http.StatusSeeOther, "/login/2fa/setup")
+	}
+	return c.Redirect(http.StatusSeeOther, "/login/2fa")
+}
+
+// completeLogin opens a session for the user and stores its tokens in cookies
+func completeLogin(c echo.Context, uc *repo.UserController, user *models.AppUser) error {
+	if err := uc.SetUserActive(user.Userid, true); err != nil {
+		log.Println("Error updating active status:", err)
+		return errors.New("failed to update active status")
+	}
+
+	pair, err := newSessionToken(c, user)
+	if err != nil {
+		return errors.New("failed to generate token")
+	}
+
+	setAuthCookies(c, pair)
+	return nil
+}
+
+// challengeUser returns the user a login challenge cookie belongs to
+func challengeUser(c echo.Context, uc *repo.UserController) (*models.AppUser, string, error) {
+	cookie, err := c.Cookie("MFA")
+	if err != nil {
+		return nil, "", errors.New("login expired")
+	}
+
+	key := "mfa:" + hashToken(cookie.Value)
+	userID, err := db.GetSessionStore().Get(key)
+	if err != nil {
+		return nil, "", errors.New("login expired")
+	}
+
+	user, err := uc.GetUserByUserid(string(userID))
+	if err != nil || user.Disabled {
+		return nil, "", errors.New("login expired")
+	}
+	return user, key, nil
+}
+
+// endChallenge forgets a finished login challenge
+func endChallenge(c echo.Context, key string) {
+	db.GetSessionStore().Delete(key)
+	c.SetCookie(&http.Cookie{Name: "MFA", Value: "", Path: "/login/2fa", Expires: time.Unix(0, 0), HttpOnly: true, Secure: middleware.SecureCookies()})
+}
+
+func loginExpired(c echo.Context) error {
+	return c.Redirect(http.StatusSeeOther, "/login?error="+url.QueryEscape("Login expired, please log in again"))
+}
+
+// TwoFactorPage asks for the code after the password
+func TwoFactorPage(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, _, err := challengeUser(c, uc); err != nil {
+			return loginExpired(c)
+		}
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title": "Two-Factor Authentication",
+			"Error": c.QueryParam("error"),
+		})
+	}
+}
+
+// PostTwoFactor checks the code or recovery code and logs the user in
+func PostTwoFactor(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, key, err := challengeUser(c, uc)
+		if err != nil {
+			return loginExpired(c)
+		}
+
+		req := new(TwoFactorRequest)
+		c.Bind(req)
+		if err := checkSecondFactor(uc, user, req); err != nil {
+			return c.Redirect(http.StatusSeeOther, "/login/2fa?error="+url.QueryEscape(err.Error()))
+		}
+
+		endChallenge(c, key)
+		if err := completeLogin(c, uc, user); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.Redirect(http.StatusSeeOther, "/boks")
+	}
+}
+
+// TwoFactorSetupPage makes a user whose role requires two-factor
+// authentication set it up before their first login completes
+func TwoFactorSetupPage(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, _, err := challengeUser(c, uc)
+		if err != nil || user.TOTPEnabled {
+			return loginExpired(c)
+		}
+
+		data := map[string]interface{}{
+			"Title": "Set Up Two-Factor Authentication",
+			"Setup": true,
+			"Error": c.QueryParam("error"),
+		}
+		secret, uri, err := setupTOTP(uc, user)
+		if err != nil {
+			data["Error"] = err.Error()
+		}
+		data["Secret"] = secret
+		data["URI"] = uri
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+}
+
+// PostTwoFactorSetup confirms the new secret, shows the recovery codes and
+// logs the user in
+func PostTwoFactorSetup(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, key, err := challengeUser(c, uc)
+		if err != nil || user.TOTPEnabled {
+			return loginExpired(c)
+		}
+
+		codes, err := enableTOTP(uc, user, c.FormValue("code"))
+		if err != nil {
+			return c.Redirect(http.StatusSeeOther, "/login/2fa/setup?error="+url.QueryEscape(err.Error()))
+		}
+
+		endChallenge(c, key)
+		if err := completeLogin(c, uc, user); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title":         "Two-Factor Authentication Enabled",
+			"RecoveryCodes": codes,
+		})
+	}
+}
+
+// SetupTOTP starts two-factor enrollment and returns the secret and its
+// provisioning URI
+func SetupTOTP(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := currentUser(c, uc)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+
+		secret, uri, err := setupTOTP(uc, user)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"secret": secret, "uri": uri})
+	}
+}
+
+// EnableTOTP confirms enrollment with a code and returns the recovery codes
+func EnableTOTP(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := currentUser(c, uc)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+
+		req := new(TwoFactorRequest)
+		c.Bind(req)
+		codes, err := enableTOTP(uc, user, req.Code)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string][]string{"recoverycodes": codes})
+	}
+}
+
+// DisableTOTP turns off two-factor authentication
+func DisableTOTP(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := currentUser(c, uc)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+
+		req := new(TwoFactorRequest)
+		c.Bind(req)
+		if err := disableTOTP(uc, user, req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// NewRecoveryCodes replaces the recovery codes
+func NewRecoveryCodes(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := currentUser(c, uc)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+
+		req := new(TwoFactorRequest)
+		c.Bind(req)
+		codes, err := regenerateRecoveryCodes(uc, user, req)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string][]string{"recoverycodes": codes})
+	}
+}
+
+// TwoFactorSettingsPage renders the logged in user's two-factor settings
+func TwoFactorSettingsPage(c echo.Context, uc *repo.UserController) error {
+	data := map[string]interface{}{
+		"Title":   "Two-Factor Authentication",
+		"Message": c.QueryParam("message"),
+		"Error":   c.QueryParam("error"),
+	}
+
+	user, err := currentUser(c, uc)
+	if err != nil {
+		data["Error"] = "Failed to load your account"
+		return c.Render(http.StatusOK, "layout.html", data)
+	}
+	data["Enabled"] = user.TOTPEnabled
+	data["Required"] = totpRequired(user)
+
+	return c.Render(http.StatusOK, "layout.html", data)
+}
+
+// PostTwoFactorAction handles the forms on the two-factor settings page
+func PostTwoFactorAction(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := map[string]interface{}{
+			"Title": "Two-Factor Authentication",
+		}
+
+		user, err := currentUser(c, uc)
+		if err != nil {
+			return c.Redirect(http.StatusSeeOther, "/login")
+		}
+		data["Enabled"] = user.TOTPEnabled
+		data["Required"] = totpRequired(user)
+
+		req := new(TwoFactorRequest)
+		c.Bind(req)
+
+		switch c.Param("action") {
+		case "setup":
+			var secret, uri string
+			if secret, uri, err = setupTOTP(uc, user); err == nil {
+				data["Setup"] = true
+				data["Secret"] = secret
+				data["URI"] = uri
+				return c.Render(http.StatusOK, "layout.html", data)
+			}
+		case "enable":
+			var codes []string
+			if codes, err = enableTOTP(uc, user, req.Code); err == nil {
+				data["Enabled"] = true
+				data["RecoveryCodes"] = codes
+				return c.Render(http.StatusOK, "layout.html", data)
+			}
+		case "recovery":
+			var codes []string
+			if codes, err = regenerateRecoveryCodes(uc, user, req); err == nil {
+				data["RecoveryCodes"] = codes
+				return c.Render(http.StatusOK, "layout.html", data)
+			}
+		case "disable":
+			if err = disableTOTP(uc, user, req); err == nil {
+				return c.Redirect(http.StatusSeeOther, "/user/2fa?message="+url.QueryEscape("Two-factor authentication turned off"))
+			}
+		default:
+			err = errors.New("unknown action")
+		}
+
+		return c.Redirect(http.StatusSeeOther, "/user/2fa?error="+url.QueryEscape(err.Error()))
+	}
+}
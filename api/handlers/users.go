@@ -1,23 +1,32 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"rethink/api/db"
+	"rethink/api/middleware"
 	"rethink/api/models"
 	"rethink/api/repo"
 	"strings"
 	"time"
 
-	r "github.com/rethinkdb/rethinkdb-go"
 	"github.com/spf13/viper"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+// defaultRole is the role given to self-registered users, set by DEFAULT_ROLE
+func defaultRole() string {
+	role := viper.GetString("DEFAULT_ROLE")
+	if role == "" {
+		role = "User"
+	}
+	return role
+}
+
 // Register handles user registration
 func Register(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -28,7 +37,6 @@ func Register(uc *repo.UserController) echo.HandlerFunc {
 		user.Name = c.FormValue("name")
 		user.Email = c.FormValue("email")
 		user.Password = c.FormValue("password")
-		user.Role = c.FormValue("role")
 		user.Gender = c.FormValue("sex")
 		user.Phone = c.FormValue("phone")
 		user.Details = c.FormValue("details")
@@ -46,21 +54,44 @@ func Register(uc *repo.UserController) echo.HandlerFunc {
 			fmt.Println("DOB not provided, skipping...")
 		}
 
+		// New accounts always get the default role; only admins can change it
+		user.Role = defaultRole()
+		exists, err := uc.RoleExists(user.Role)
+		if err != nil || !exists {
+			log.Println("Default role is not defined in the roles table:", user.Role, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "registration is unavailable"})
+		}
+
+		// Enforce the password policy
+		if problems := db.ValidatePassword(user.Password, user.Email, user.Name); len(problems) > 0 {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title":          "Register",
+				"Error":          "Password does not meet the requirements",
+				"PasswordErrors": problems,
+			})
+		}
+
 		// Generate a new UUID for Userid
 		user.Userid = uuid.New().String()
 		user.CreatedAt = time.Now()
 		user.UpdatedAt = time.Now()
+		user.Verified = false
 
 		// Add user to the database
-		_, err := uc.AddUser(user)
+		_, err = uc.AddUser(user)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
 
+		// Send the verification link; the user can request a new one if this fails
+		if err := sendVerificationEmail(&user); err != nil {
+			log.Println("Error sending verification email:", err)
+		}
+
 		// Return success response with user info and token
 		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 			"Title":   "Register",
-			"Message": "User created successfully!",
+			"Message": "User created successfully! Check your email for a link to verify your account.",
 		})
 	}
 }
@@ -70,6 +101,10 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// dummyPasswordHash is checked when the email is unknown, so a failed login
+// takes as long whether or not the account exists
+const dummyPasswordHash = "$2a$10$ZyurSi02mjNH7PQj7GR8wOV2nJEr.NVG6T3.Rrub89xY0n1lRb1Si"
+
 // Login handles user authentication and JWT generation
 func Login(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -85,53 +120,54 @@ func Login(uc *repo.UserController) echo.HandlerFunc {
 		}
 		fmt.Printf("Attempting login with email: %s\n", loginRequest.Email)
 
-		// Fetch the user from the database by Email
-		user, err := uc.GetUserByEmail(loginRequest.Email)
-		if err != nil {
-			fmt.Println("User not found in DB:", loginRequest.Email)
+		// Refuse attempts while the account or address is backed off or locked
+		ip := c.RealIP()
+		if _, blocked := loginBlocked(loginRequest.Email, ip); blocked {
 			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 				"Title": "Login",
-				"Error": "Incorrect Email!!",
+				"Error": "Too many failed login attempts. Please try again later.",
 			})
 		}
 
-		// Compare the provided password with the stored hashed password
-		if !db.CheckHashedPassword(loginRequest.Password, user.Password) {
-			fmt.Println("Incorrect password for user:", loginRequest.Email)
+		// Unknown emails and wrong passwords get the same answer so the
+		// response doesn't reveal which accounts exist
+		user, err := uc.GetUserByEmail(loginRequest.Email)
+		hash := dummyPasswordHash
+		if err == nil {
+			hash = user.Password
+		}
+		if !db.CheckHashedPassword(loginRequest.Password, hash) || err != nil {
+			recordLoginFailure(loginRequest.Email, ip)
 			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 				"Title": "Login",
-				"Error": "Incorrect Password!!!",
+				"Error": "Invalid email or password",
 			})
 		}
 
-		// Set active = true in the database
-		res, err := r.Table("users").
-			Filter(r.Row.Field("Email").Eq(user.Email)).
-			Update(map[string]interface{}{"Active": true}).
-			RunWrite(uc.GetSession())
-
-		if err != nil {
-			fmt.Println("Error updating active status:", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update active status"})
+		if err := clearLoginFailures(loginRequest.Email); err != nil {
+			log.Println("Error clearing failed logins:", err)
 		}
 
-		fmt.Printf("Update result: %+v\n", res)
-
-		// Generate the JWT token
-		token, err := generateJWT(user)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to generate token"})
+		// Deactivated accounts can't log in
+		if user.Disabled {
+			fmt.Println("Login attempt on deactivated account:", loginRequest.Email)
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Login",
+				"Error": "This account has been deactivated",
+			})
 		}
 
-		// Store token in session
-		c.SetCookie(&http.Cookie{
-			Name:     "Authorization",
-			Value:    "Bearer " + token,
-			HttpOnly: true,
-			Path:     "/",
-		})
+		// Unverified accounts can't log in
+		if !user.Verified {
+			fmt.Println("Login attempt on unverified account:", loginRequest.Email)
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Login",
+				"Error": "Please verify your email before logging in. You can request a new link at /verify/resend",
+			})
+		}
 
-		return c.Redirect(http.StatusSeeOther, "/boks")
+		// Ask for the second factor if the user needs one, else log in
+		return beginLogin(c, uc, user)
 	}
 }
 
@@ -139,61 +175,17 @@ func Login(uc *repo.UserController) echo.HandlerFunc {
 func GetUser(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
-		// Extract JWT token from cookies
-		cookie, err := c.Cookie("Authorization")
-		if err != nil {
-			fmt.Println("Error: JWT token not found in cookies")
-			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
-				"Title": "User Details",
-				"Error": "Unauthorized: No token found",
-			})
-		}
-
-		// Remove "Bearer " prefix from the token
-		tokenString := strings.TrimPrefix(cookie.Value, "Bearer ")
-		fmt.Println("Extracted Token:", tokenString)
-
-		// Parse the JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Ensure the correct signing method is used
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(getJWTSecret()), nil
-		})
-
-		// Check if the token is valid
-		if err != nil || !token.Valid {
-			fmt.Println("Error: Invalid JWT token -", err)
-			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
-				"Title": "User Details",
-				"Error": "Invalid token",
-			})
-		}
-
-		// Extract claims from the token
-		claims, ok := token.Claims.(jwt.MapClaims)
+		principal, ok := middleware.CurrentPrincipal(c)
 		if !ok {
-			fmt.Println("Error: JWT claims conversion failed")
+			fmt.Println("Error: User context is missing")
 			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 				"Title": "User Details",
-				"Error": "Invalid token claims",
-			})
-		}
-
-		// Extract email
-		email, exists := claims["email"].(string)
-		if !exists {
-			fmt.Println("Error: email not found in claims")
-			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
-				"Title": "User Details",
-				"Error": "Invalid token format",
+				"Error": "Unauthorized: No token found",
 			})
 		}
-		fmt.Println("Extracted Email:", email)
 
 		// Fetch user from database
-		userData, err := uc.GetUserByEmail(email)
+		userData, err := uc.GetUserByEmail(principal.Email)
 		if err != nil {
 			fmt.Println("Error fetching user from DB:", err)
 			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
@@ -222,52 +214,138 @@ func GetUser(uc *repo.UserController) echo.HandlerFunc {
 	}
 }
 
-// UpdateUser updates user profile
+// profileFields maps the updatable profile fields to their database keys.
+// Details has no rethinkdb tag on the model, so it is stored under its Go name.
+// Roles are changed by admins only, through AdminSetRole.
+var profileFields = map[string]string{
+	"name":    "name",
+	"gender":  "gender",
+	"details": "Details",
+	"phone":   "phone",
+	"dob":     "dob",
+}
+
+// parseDob accepts a date (YYYY-MM-DD) or a full RFC 3339 timestamp
+func parseDob(value string) (time.Time, error) {
+	if dob, err := time.Parse("2006-01-02", value); err == nil {
+		return dob, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// profilePatch collects the profile fields present in the request. JSON
+// bodies are read as a merge patch, where null clears a field. Form posts
+// send every input, so blank form values leave the field unchanged.
+func profilePatch(c echo.Context) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) ||
+		strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "application/merge-patch+json") {
+		var body map[string]interface{}
+		if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+			return nil, fmt.Errorf("invalid JSON body")
+		}
+		for key, value := range body {
+			if _, ok := profileFields[key]; !ok {
+				return nil, fmt.Errorf("field %q can't be updated", key)
+			}
+			if value == nil {
+				values[key] = ""
+				continue
+			}
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("field %q must be a string", key)
+			}
+			values[key] = str
+		}
+	} else {
+		for key := range profileFields {
+			formKey := key
+			if key == "gender" {
+				formKey = "sex"
+			}
+			if value := c.FormValue(formKey); value != "" {
+				values[key] = value
+			}
+		}
+	}
+
+	fields := map[string]interface{}{}
+	for key, value := range values {
+		if key == "dob" && value != "" {
+			dob, err := parseDob(value.(string))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid date format. Use YYYY-MM-DD")
+			}
+			value = dob
+		} else if key == "dob" {
+			value = time.Time{}
+		}
+		fields[profileFields[key]] = value
+	}
+
+	return fields, nil
+}
+
+// UpdateUser partially updates the logged in user's profile. Only the fields
+// present in the request change. The API returns the updated user; the form
+// renders a page. Admins edit other accounts through the admin API.
 func UpdateUser(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Extract email from the URL
-		fmt.Println("Form values received:", c.Request().Form)
-		email := c.FormValue("email")
+		// The API names the user in the URL, the form confirms it in a field
+		isAPI := c.Param("email") != ""
+		email := c.Param("email")
+		if !isAPI {
+			email = c.FormValue("email")
+		}
 		if email == "" {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "email is required"})
 		}
 
-		// Log user ID for debugging
-		fmt.Println("Updating user with email:", email)
+		userID, ok := currentUserID(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
 
 		// Fetch user from database
-		userData, err := uc.GetUserByEmail(email)
+		userData, err := uc.GetUserByUserid(userID)
 		if err != nil {
 			fmt.Println("Error fetching user from DB:", err)
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+		}
+
+		if !strings.EqualFold(email, userData.Email) {
+			if isAPI {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "you can only update your own profile"})
+			}
 			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 				"Title": "Update User : ",
-				"Error": "No user found for input email!",
+				"Error": "You can only update your own profile",
 			})
 		}
 
-		// Manually bind form data
-		var updatedUser models.AppUser
-		updatedUser.Name = c.FormValue("name")
-		updatedUser.Role = c.FormValue("role")
-		updatedUser.Gender = c.FormValue("sex")
-		updatedUser.Details = c.FormValue("details")
-		updatedUser.Phone = c.FormValue("phone")
-		updatedUser.Password = db.HashPassword(c.FormValue("password"))
-		updatedUser.Email = email
-
-		//field you dont want to change
-		userData.CreatedAt = updatedUser.CreatedAt
-		userData.Userid = updatedUser.Userid
-		userData.Dob = updatedUser.Dob
-
-		//changable fields
-		updatedUser.UpdatedAt = time.Now()
+		fields, err := profilePatch(c)
+		if err != nil {
+			if isAPI {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Update User",
+				"Error": err.Error(),
+			})
+		}
 
 		// Update user in DB
-		err = uc.UpdateUser(email, updatedUser)
+		updated, err := uc.UpdateUser(userData.Userid, fields)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
+		updated.Password = ""
+
+		if isAPI {
+			return c.JSON(http.StatusOK, updated)
+		}
 
 		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 			"Title":   "Update User",
@@ -276,29 +354,101 @@ func UpdateUser(uc *repo.UserController) echo.HandlerFunc {
 	}
 }
 
-// DeleteUser removes a user from the system
+type DeleteAccountRequest struct {
+	Password   string `json:"password" form:"password"`
+	Books      string `json:"books" form:"books"`
+	TransferTo string `json:"transferto" form:"transferto"`
+}
+
+// deleteAccount deletes a user with their data and ends all of their sessions
+// and API tokens
+func deleteAccount(uc *repo.UserController, user *models.AppUser, books, transferTo, performedBy string) error {
+	if err := uc.DeleteUser(user.Userid, books, transferTo, performedBy); err != nil {
+		return err
+	}
+
+	if err := revokeSessions(user.Userid); err != nil {
+		log.Println("Error revoking sessions of deleted user:", err)
+	}
+	if err := revokeAPITokens(user.Userid); err != nil {
+		log.Println("Error revoking API tokens of deleted user:", err)
+	}
+	if err := clearLoginFailures(user.Email); err != nil {
+		log.Println("Error clearing failed logins of deleted user:", err)
+	}
+
+	return nil
+}
+
+// deleteOwnAccount checks the logged in user's password and deletes their
+// account. Books can be handed to another user, named by email.
+func deleteOwnAccount(c echo.Context, uc *repo.UserController, email string, req *DeleteAccountRequest) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return fmt.Errorf("unauthorized")
+	}
+
+	user, err := uc.GetUserByUserid(userID)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(email, user.Email) {
+		return fmt.Errorf("you can only delete your own account")
+	}
+	if !db.CheckHashedPassword(req.Password, user.Password) {
+		return fmt.Errorf("incorrect password")
+	}
+
+	transferTo := ""
+	if req.Books == models.BooksTransfer {
+		recipient, err := uc.GetUserByEmail(req.TransferTo)
+		if err != nil {
+			return fmt.Errorf("user to transfer books to not found")
+		}
+		transferTo = recipient.Userid
+	}
+
+	if err := deleteAccount(uc, user, req.Books, transferTo, user.Userid); err != nil {
+		return err
+	}
+
+	// Clear the cookies in the response
+	clearAuthCookies(c)
+
+	return nil
+}
+
+// DeleteUser deletes the logged in user's account after confirming their password
 func DeleteUser(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		req := new(DeleteAccountRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
 
-		// Get email from URL
-		email := c.FormValue("email")
-		fmt.Println("Deleting user with email:", email)
+		if err := deleteOwnAccount(c, uc, c.Param("email"), req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
 
-		if email == "" {
-			fmt.Println("Error: Email is missing in form submission")
-			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
-				"Title": "Delete User : ",
-				"Error": "Email cannot be empty.",
-			})
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// PostDeleteUser handles the delete account form
+func PostDeleteUser(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := &DeleteAccountRequest{
+			Password:   c.FormValue("password"),
+			Books:      c.FormValue("books"),
+			TransferTo: c.FormValue("transferto"),
 		}
 
-		// delete user from db
-		err := uc.DeleteUser(email)
-		if err != nil {
+		if err := deleteOwnAccount(c, uc, c.FormValue("email"), req); err != nil {
 			fmt.Println("Error deleting user:", err)
 			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 				"Title": "Delete User : ",
-				"Error": "No user with this email found.",
+				"Error": err.Error(),
 			})
 		}
 
@@ -309,79 +459,34 @@ func DeleteUser(uc *repo.UserController) echo.HandlerFunc {
 // Logout invalidates the user's session
 func Logout(uc *repo.UserController) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Retrieve the token from cookies instead of the Authorization header
-		cookie, err := c.Cookie("Authorization")
-		if err != nil {
-			log.Println("Error: Authorization cookie missing")
+		// API tokens have no session to end; they are revoked instead
+		principal, ok := middleware.CurrentPrincipal(c)
+		if !ok || principal.Method != middleware.AuthSession {
+			log.Println("Error: Logout without a login session")
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authorization token missing"})
 		}
 
-		// Extract the token value
-		tokenString := strings.TrimPrefix(cookie.Value, "Bearer ")
-
-		// Validate and parse the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(viper.GetString("JWT_SECRET")), nil
-		})
-
-		if err != nil {
-			log.Println("Error parsing token:", err)
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token"})
-		}
-
-		// Extract claims from token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token claims"})
-		}
-
-		userID, ok := claims["userid"].(string)
-		if !ok {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid user ID in token"})
-		}
-		Email := claims["email"].(string)
-
-		// Fetch the user from the database by Email
-		user, err := uc.GetUserByEmail(Email)
-		if err != nil {
-			fmt.Println("User not found in DB:", Email)
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid email"})
-		}
-
-		// Set active = false in the database
-		res, err := r.Table("users").
-			Filter(r.Row.Field("Email").Eq(user.Email)).
-			Update(map[string]interface{}{"Active": false}).
-			RunWrite(uc.GetSession())
+		userID := principal.Userid
 
-		if err != nil {
-			fmt.Println("Error updating active status:", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update active status"})
+		// End this device's session only; other devices stay logged in
+		if err := db.DeleteSession(userID, principal.SessionID); err != nil {
+			log.Println("Error deleting session:", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to log out"})
 		}
 
-		fmt.Printf("Update result: %+v\n", res) // Print update result
-
-		// Remove the token from Redis
-		redisClient := db.GetRedisClient()
-		err = redisClient.Del("jwt:" + userID).Err()
-		if err != nil {
-			log.Println("Error deleting token from Redis:", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to log out"})
+		// Set active = false in the database once no session is left
+		remaining, err := db.ListSessions(userID)
+		if err == nil && len(remaining) == 0 {
+			if err := uc.SetUserActive(userID, false); err != nil {
+				fmt.Println("Error updating active status:", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update active status"})
+			}
 		}
 
-		// Clear the cookie in the response
-		c.SetCookie(&http.Cookie{
-			Name:     "Authorization",
-			Value:    "",
-			Expires:  time.Unix(0, 0),
-			Path:     "/",
-			HttpOnly: true,
-		})
+		// Clear the cookies in the response
+		clearAuthCookies(c)
 
-		log.Println("Token removed from Redis for user:", userID)
+		log.Println("Session removed for user:", userID)
 
 		return c.Redirect(http.StatusFound, "/login")
 	}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"rethink/api/auth"
+	"rethink/api/mail"
+	"rethink/api/models"
+	"rethink/api/repo"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// verificationTTL is how long an email verification link stays valid
+const verificationTTL = 24 * time.Hour
+
+// appURL is the public base URL used in links sent by email
+func appURL() string {
+	base := viper.GetString("APP_URL")
+	if base == "" {
+		base = "http://localhost:8090"
+	}
+	return base
+}
+
+// generateVerificationToken signs a token proving ownership of the user's
+// current email address. The purpose claim keeps it from being accepted as a
+// session token and vice versa.
+func generateVerificationToken(user *models.AppUser) (string, error) {
+	claims := jwt.MapClaims{
+		"purpose": "verify_email",
+		"userid":  user.Userid,
+		"email":   user.Email,
+		"exp":     time.Now().Add(verificationTTL).Unix(),
+	}
+
+	key, err := auth.Secret()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(key)
+}
+
+// parseVerificationToken checks the signature, expiry and purpose of a
+// verification token and returns its user ID and email
+func parseVerificationToken(tokenString string) (string, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return auth.Secret()
+	})
+	if err != nil || !token.Valid {
+		return "", "", errors.New("invalid or expired verification link")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "verify_email" {
+		return "", "", errors.New("invalid verification link")
+	}
+
+	userID, _ := claims["userid"].(string)
+	email, _ := claims["email"].(string)
+	if userID == "" || email == "" {
+		return "", "", errors.New("invalid verification link")
+	}
+
+	return userID, email, nil
+}
+
+// sendVerificationEmail mails the user a link to verify their address
+func sendVerificationEmail(user *models.AppUser) error {
+	token, err := generateVerificationToken(user)
+	if err != nil {
+		return err
+	}
+
+	link := appURL() + "/verify?token=" + url.QueryEscape(token)
+	return mail.GetMailer().Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %d hours.",
+			user.Name, link, int(verificationTTL.Hours())),
+	})
+}
+
+// VerifyEmail marks the account as verified when the link is valid
+func VerifyEmail(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, email, err := parseVerificationToken(c.QueryParam("token"))
+		if err != nil {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Verify Email",
+				"Error": err.Error(),
+			})
+		}
+
+		// Links for an address the account no longer uses are rejected
+		user, err := uc.GetUserByUserid(userID)
+		if err != nil || user.Email != email {
+			return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+				"Title": "Verify Email",
+				"Error": "invalid verification link",
+			})
+		}
+
+		if !user.Verified {
+			if err := uc.MarkEmailVerified(userID); err != nil {
+				log.Println("Error marking email verified:", err)
+				return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+					"Title": "Verify Email",
+					"Error": "Failed to verify email, please try again",
+				})
+			}
+		}
+
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title":   "Verify Email",
+			"Message": "Your email is verified. You can now log in.",
+		})
+	}
+}
+
+// ResendVerification sends a new verification link. The response is the same
+// whether or not the address belongs to an unverified account.
+func ResendVerification(uc *repo.UserController) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email := c.FormValue("email")
+
+		user, err := uc.GetUserByEmail(email)
+		if err == nil && !user.Verified {
+			if err := sendVerificationEmail(user); err != nil {
+				log.Println("Error sending verification email:", err)
+			}
+		}
+
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title":   "Resend Verification Email",
+			"Message": "If that address belongs to an unverified account, a new verification link is on its way.",
+		})
+	}
+}
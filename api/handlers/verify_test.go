@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/url"
+	"rethink/api/mail"
+	"rethink/api/models"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSendVerificationEmail(t *testing.T) {
+	viper.Set("JWT_SECRET", "test-secret")
+	viper.Set("APP_URL", "https://library.example.com")
+	sink := mail.NewMemoryMailer()
+	mail.SetMailer(sink)
+
+	user := &models.AppUser{Userid: "user-1", Email: "reader@example.com", Name: "Reader"}
+	if err := sendVerificationEmail(user); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := sink.Last("reader@example.com")
+	if !ok {
+		t.Fatal("no verification email sent")
+	}
+	if len(sink.Messages()) != 1 {
+		t.Errorf("sent %d messages, want 1", len(sink.Messages()))
+	}
+	if msg.Subject != "Verify your email address" {
+		t.Errorf("subject = %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Body, "Hi Reader,") {
+		t.Errorf("body doesn't greet the user:\n%s", msg.Body)
+	}
+
+	// The link in the body verifies this user's current address
+	var link *url.URL
+	for _, field := range strings.Fields(msg.Body) {
+		if strings.HasPrefix(field, "https://library.example.com/verify?") {
+			link, _ = url.Parse(field)
+		}
+	}
+	if link == nil {
+		t.Fatalf("no verification link in the body:\n%s", msg.Body)
+	}
+
+	userID, email, err := parseVerificationToken(link.Query().Get("token"))
+	if err != nil || userID != "user-1" || email != "reader@example.com" {
+		t.Errorf("link token = %q, %q, %v, want user-1 and reader@example.com", userID, email, err)
+	}
+}
@@ -18,8 +18,14 @@ type TemplateRenderer struct {
 	templates *template.Template
 }
 
-// Render renders a template
+// Render renders a template. The request's CSRF token is added to the data
+// as CSRF for the forms to send back.
 func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	if m, ok := data.(map[string]interface{}); ok {
+		if _, set := m["CSRF"]; !set {
+			m["CSRF"] = c.Get("csrf")
+		}
+	}
 	return t.templates.ExecuteTemplate(w, name, data)
 }
 
@@ -42,11 +48,36 @@ func UserRoute(e *echo.Echo, uc *repo.UserController) {
 		e.Renderer = renderer
 		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 			"Title": "Login",
+			"Error": c.QueryParam("error"),
+			"SSO":   oidcProvider() != nil,
 		})
 	})
 
 	e.POST("/login", Login(uc))
 
+	//second login step for two-factor authentication
+	e.GET("/login/2fa", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/login2fa.html")
+		e.Renderer = renderer
+		return TwoFactorPage(uc)(c)
+	})
+	e.POST("/login/2fa", PostTwoFactor(uc))
+
+	//set up two-factor authentication required by the user's role
+	e.GET("/login/2fa/setup", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/login2fa.html")
+		e.Renderer = renderer
+		return TwoFactorSetupPage(uc)(c)
+	})
+	e.POST("/login/2fa/setup", PostTwoFactorSetup(uc))
+
+	//sign in with the OIDC provider
+	e.GET("/login/oidc", OIDCLogin)
+	e.GET("/login/oidc/callback", OIDCCallback(uc))
+
+	//renew the browser's tokens and go back to the page
+	e.GET("/token/refresh", RefreshRedirect(uc))
+
 	//load register page
 	e.GET("/register", func(c echo.Context) error {
 		renderer := loadTemplates("api/web/register.html")
@@ -58,8 +89,46 @@ func UserRoute(e *echo.Echo, uc *repo.UserController) {
 
 	e.POST("/register", Register(uc))
 
+	//verify email from the emailed link
+	e.GET("/verify", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/verify.html")
+		e.Renderer = renderer
+		return VerifyEmail(uc)(c)
+	})
+
+	//load resend verification page
+	e.GET("/verify/resend", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/verifyresend.html")
+		e.Renderer = renderer
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title": "Resend Verification Email",
+		})
+	})
+
+	e.POST("/verify/resend", ResendVerification(uc))
+
+	//load forgot password page
+	e.GET("/password/forgot", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/passwordforgot.html")
+		e.Renderer = renderer
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title": "Forgot Password",
+		})
+	})
+
+	e.POST("/password/forgot", ForgotPassword(uc))
+
+	//load reset password page
+	e.GET("/password/reset", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/passwordreset.html")
+		e.Renderer = renderer
+		return ResetPasswordPage(c)
+	})
+
+	e.POST("/password/reset", ResetPassword(uc))
+
 	//load details page
-	e.GET("/user/details", func(c echo.Context) error {
+	e.GET("/user/details", middleware.SessionAuth(func(c echo.Context) error {
 		handler := GetUser(repo.NewUserController(uc.GetSession()))
 
 		// Call the handler function to get user details
@@ -85,29 +154,70 @@ func UserRoute(e *echo.Echo, uc *repo.UserController) {
 			"Title": "User Details : ",
 			"User":  userData,
 		})
-	})
+	}))
 
 	//load update page
-	e.GET("/user/update", func(c echo.Context) error {
+	e.GET("/user/update", middleware.SessionAuth(func(c echo.Context) error {
 		renderer := loadTemplates("api/web/userupdate.html")
 		e.Renderer = renderer
 		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 			"Title": "Update User : ",
 		})
-	})
+	}))
 
-	e.POST("/user/update", UpdateUser(uc))
+	e.POST("/user/update", middleware.SessionAuth(UpdateUser(uc)))
+
+	//load change password page
+	e.GET("/user/password", middleware.SessionAuth(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/userpassword.html")
+		e.Renderer = renderer
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title": "Change Password",
+		})
+	}))
+
+	e.POST("/user/password", middleware.SessionAuth(PostChangePassword(uc)))
+
+	//load sessions page
+	e.GET("/user/sessions", middleware.SessionAuth(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/usersessions.html")
+		e.Renderer = renderer
+		return SessionsPage(c)
+	}))
+
+	//log out one or all other sessions
+	e.POST("/user/sessions/:action", middleware.SessionAuth(PostSessionAction))
+
+	//load API tokens page
+	e.GET("/user/tokens", middleware.SessionAuth(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/usertokens.html")
+		e.Renderer = renderer
+		return APITokensPage(c, uc, nil)
+	}))
+
+	//create or revoke an API token
+	e.POST("/user/tokens/:action", middleware.SessionAuth(PostAPITokenAction(uc)))
+
+	//load two-factor authentication settings page
+	e.GET("/user/2fa", middleware.SessionAuth(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/user2fa.html")
+		e.Renderer = renderer
+		return TwoFactorSettingsPage(c, uc)
+	}))
+
+	//set up, turn off or get new recovery codes for two-factor authentication
+	e.POST("/user/2fa/:action", middleware.SessionAuth(PostTwoFactorAction(uc)))
 
 	//load delete page
-	e.GET("/user/delete", func(c echo.Context) error {
+	e.GET("/user/delete", middleware.SessionAuth(func(c echo.Context) error {
 		renderer := loadTemplates("api/web/userdelete.html")
 		e.Renderer = renderer
 		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
 			"Title": "Delete User Account",
 		})
-	})
+	}))
 
-	e.POST("/user/delete", DeleteUser(uc))
+	e.POST("/user/delete", middleware.SessionAuth(PostDeleteUser(uc)))
 
 	e.GET("/user/logout", func(c echo.Context) error {
 		renderer := loadTemplates("api/web/userlogout.html")
@@ -117,11 +227,11 @@ func UserRoute(e *echo.Echo, uc *repo.UserController) {
 		})
 	})
 
-	e.POST("/user/logout", Logout(uc))
+	e.POST("/user/logout", middleware.LogoutAuth(Logout(uc)))
 
 }
 
-func BooksRoute(e *echo.Echo, bc *repo.BookController) {
+func BooksRoute(e *echo.Echo, bc *repo.BookController, uc *repo.UserController) {
 
 	//load books page
 	e.GET("/boks", func(c echo.Context) error {
@@ -136,7 +246,7 @@ func BooksRoute(e *echo.Echo, bc *repo.BookController) {
 	e.GET("/books/all", func(c echo.Context) error {
 		// Fetch books from the database
 		bc := repo.NewBookController(db.DB)
-		books, err := bc.GetBooks()
+		books, err := bc.GetBooksSorted(c.QueryParam("sort"))
 		if err != nil {
 			return c.Render(http.StatusOK, "layout2.html", map[string]interface{}{
 				"Title": "All Books",
@@ -154,7 +264,7 @@ func BooksRoute(e *echo.Echo, bc *repo.BookController) {
 	})
 
 	//load a specific book
-	e.GET("/books/id", func(c echo.Context) error {
+	e.GET("/books/id", middleware.OptionalAuth(func(c echo.Context) error {
 		// Extract the "id" parameter from the query string if it exists
 		bookIDParam := c.QueryParam("id")
 
@@ -183,6 +293,22 @@ func BooksRoute(e *echo.Echo, bc *repo.BookController) {
 			} else {
 				// If the book is found, add it to the data map
 				data["Book"] = book
+
+				// Load the reviews for the book; moderators also see hidden ones
+				moderator := canModerate(c, repo.NewUserController(db.DB))
+				data["Moderator"] = moderator
+				rc := repo.NewReviewController(db.DB)
+				reviews, err := rc.GetReviews(bookID, moderator)
+				if err == nil {
+					data["Reviews"] = reviews
+				}
+
+				// Load the physical copies of the book
+				cc := repo.NewCopyController(db.DB)
+				copies, err := cc.GetCopies(bookID)
+				if err == nil {
+					data["Copies"] = copies
+				}
 			}
 		}
 
@@ -190,27 +316,31 @@ func BooksRoute(e *echo.Echo, bc *repo.BookController) {
 		renderer := loadTemplates("api/web/bookbyid.html")
 		e.Renderer = renderer
 		return c.Render(http.StatusOK, "layout.html", data)
-	})
+	}))
 
 	//create a new book
 	e.GET("/books/create", func(c echo.Context) error {
+		authors, _ := repo.NewAuthorController(db.DB).GetAuthors()
 		renderer := loadTemplates("api/web/bookcreate.html")
 		e.Renderer = renderer
 		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
-			"Title": "Create a New Book : ",
+			"Title":   "Create a New Book : ",
+			"Authors": authors,
 		})
 	})
-	e.POST("/books/create", middleware.AuthMiddleware(Createbook(bc)))
+	e.POST("/books/create", middleware.AuthMiddleware(middleware.CheckAccess(uc, "book_create")(Createbook(bc))))
 
 	//update a book
 	e.GET("/books/update", func(c echo.Context) error {
+		authors, _ := repo.NewAuthorController(db.DB).GetAuthors()
 		renderer := loadTemplates("api/web/bookupdate.html")
 		e.Renderer = renderer
 		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
-			"Title": "Update Book : ",
+			"Title":   "Update Book : ",
+			"Authors": authors,
 		})
 	})
-	e.POST("/books/update", middleware.AuthMiddleware(Updatebook(bc)))
+	e.POST("/books/update", middleware.AuthMiddleware(middleware.CheckAccess(uc, "book_update")(Updatebook(bc))))
 
 	//delete a book
 	e.GET("/books/delete", func(c echo.Context) error {
@@ -220,6 +350,108 @@ func BooksRoute(e *echo.Echo, bc *repo.BookController) {
 			"Title": "Delete Book : ",
 		})
 	})
-	e.POST("/books/delete", Deletebook(bc))
+	e.POST("/books/delete", middleware.AuthMiddleware(middleware.CheckAccess(uc, "book_delete")(Deletebook(bc))))
+
+}
+
+func ReviewsRoute(e *echo.Echo, rc *repo.ReviewController, bc *repo.BookController, uc *repo.UserController) {
+
+	//review a book from its details page
+	e.POST("/books/review", middleware.AuthMiddleware(middleware.CheckAccess(uc, "review_create")(PostReview(rc, bc))))
+
+	//hide or restore a review
+	e.POST("/reviews/hide", middleware.AuthMiddleware(middleware.CheckAccess(uc, "review_moderate")(PostHideReview(rc))))
+
+}
+
+func ListsRoute(e *echo.Echo, lc *repo.ListController, bc *repo.BookController) {
+
+	//load reading lists page
+	e.GET("/user/lists", middleware.SessionAuth(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/userlists.html")
+		e.Renderer = renderer
+		return UserListsPage(lc)(c)
+	}))
+
+	//create, rename, share, reorder and delete reading lists
+	e.POST("/user/lists/:action", middleware.SessionAuth(PostListAction(lc, bc)))
+
+	//load a shared reading list
+	e.GET("/shared/:token", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/sharedlist.html")
+		e.Renderer = renderer
+		return SharedListPage(lc)(c)
+	})
+
+}
+
+func StatsRoute(e *echo.Echo, sc *repo.StatsController, uc *repo.UserController) {
+
+	//load statistics page
+	e.GET("/stats/page", middleware.AuthMiddleware(middleware.CheckAccess(uc, "stats_read")(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/stats.html")
+		e.Renderer = renderer
+		return StatsPage(sc)(c)
+	})))
+
+}
+
+func ExportRoute(e *echo.Echo, uc *repo.UserController, ec *repo.ExportController) {
+
+	//load data export page
+	e.GET("/user/export", middleware.SessionAuth(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/userexport.html")
+		e.Renderer = renderer
+		return c.Render(http.StatusOK, "layout.html", map[string]interface{}{
+			"Title": "Export My Data",
+		})
+	}))
+
+	e.POST("/user/export", middleware.SessionAuth(PostExport(uc, ec)))
+
+}
+
+func AuthorsRoute(e *echo.Echo, ac *repo.AuthorController, uc *repo.UserController) {
+
+	//load authors page
+	e.GET("/authors/all", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/authors.html")
+		e.Renderer = renderer
+		return AuthorsPage(ac)(c)
+	})
+
+	//load a specific author with their books
+	e.GET("/authors/id", func(c echo.Context) error {
+		renderer := loadTemplates("api/web/authorbyid.html")
+		e.Renderer = renderer
+		return AuthorPage(ac)(c)
+	})
+
+	//create a new author
+	e.POST("/authors/create", middleware.AuthMiddleware(middleware.CheckAccess(uc, "author_create")(PostAuthor(ac))))
+
+	//merge duplicate authors
+	e.POST("/authors/merge", middleware.AuthMiddleware(middleware.CheckAccess(uc, "author_merge")(PostMergeAuthors(ac))))
+
+}
+
+func AdminRoute(e *echo.Echo, uc *repo.UserController) {
+
+	//load user management page
+	e.GET("/admin/users", middleware.AuthMiddleware(middleware.CheckAccess(uc, "user_manage")(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/adminusers.html")
+		e.Renderer = renderer
+		return AdminUsersPage(uc)(c)
+	})))
+
+	//load a user's profile for management
+	e.GET("/admin/users/view", middleware.AuthMiddleware(middleware.CheckAccess(uc, "user_manage")(func(c echo.Context) error {
+		renderer := loadTemplates("api/web/adminuser.html")
+		e.Renderer = renderer
+		return AdminUserPage(uc)(c)
+	})))
+
+	//change role, activate, deactivate, force logout, unlock or delete
+	e.POST("/admin/users/:action", middleware.AuthMiddleware(middleware.CheckAccess(uc, "user_manage")(PostAdminUserAction(uc))))
 
 }
@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"log"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var mailer Mailer
+
+// InitMailer sets up the mailer selected by MAIL_DRIVER in config.json:
+// "smtp", "outbox" (write to MAIL_OUTBOX, or stdout when unset) or "memory".
+// Without a driver the outbox on stdout is used so development needs no SMTP server.
+func InitMailer() {
+	from := viper.GetString("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch driver := viper.GetString("MAIL_DRIVER"); driver {
+	case "smtp":
+		mailer = NewSMTPMailer(
+			viper.GetString("SMTP_HOST"),
+			viper.GetString("SMTP_PORT"),
+			viper.GetString("SMTP_USER"),
+			viper.GetString("SMTP_PASSWORD"),
+			from,
+		)
+	case "memory":
+		mailer = NewMemoryMailer()
+	case "", "outbox":
+		path := viper.GetString("MAIL_OUTBOX")
+		if path == "" {
+			mailer = NewOutboxMailer(os.Stdout, from)
+			break
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatal("Failed to open mail outbox:", err)
+		}
+		mailer = NewOutboxMailer(file, from)
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER %q in config.json", driver)
+	}
+}
+
+// SetMailer replaces the mailer, e.g. with a MemoryMailer in tests
+func SetMailer(m Mailer) {
+	mailer = m
+}
+
+func GetMailer() Mailer {
+	return mailer
+}
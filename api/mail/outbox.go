@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// OutboxMailer writes messages to a file or stdout instead of sending them
+type OutboxMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewOutboxMailer creates an OutboxMailer writing to w
+func NewOutboxMailer(w io.Writer, from string) *OutboxMailer {
+	return &OutboxMailer{w: w, from: from}
+}
+
+// Send appends the message to the outbox
+func (m *OutboxMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "----- %s -----\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), m.from, msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -1,89 +1,171 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"rethink/api/auth"
 	"rethink/api/db"
 	"strings"
 
-	"github.com/go-redis/redis"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
-	"github.com/spf13/viper"
 )
 
-// AuthMiddleware validates JWT tokens
+// Reasons a request fails to authenticate, sent back as the error message.
+// An expired access token fails with jwt.ErrTokenExpired.
+var (
+	errMissingToken = errors.New("missing authorization token")
+	errInvalidToken = errors.New("invalid token")
+	errNoSession    = errors.New("token expired or not found")
+)
+
+// AuthMiddleware authenticates the request with an access token, from the
+// Authorization header or cookie, or a personal access token in the header.
+// Handlers read the caller with CurrentPrincipal. A personal access token
+// only gets a Principal on routes guarded by CheckAccess.
 func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
-		var tokenString string
-		authHeader := c.Request().Header.Get("Authorization")
-
-		// Check if the Authorization header is present
-		authHeader = c.Request().Header.Get("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-		} else {
-			// If not found, fallback to checking the cookie
-			cookie, err := c.Cookie("Authorization")
-			if err != nil {
-				log.Println("Error: Authorization token missing from headers and cookies")
-				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "missing authorization token"})
-			}
-			tokenString = cookie.Value
-		}
-		// Ensure "Bearer " is removed if stored in the cookie
-		if strings.HasPrefix(tokenString, "Bearer ") {
-			tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-		}
+		principal, fromCookie, err := authenticate(c, false)
 
-		// Parse and verify JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		// Access tokens are short-lived. Browsers renew theirs with the refresh
+		// cookie and come back; API clients call /token/refresh themselves.
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			if fromCookie && c.Request().Method == http.MethodGet {
+				return c.Redirect(http.StatusSeeOther, "/token/refresh?next="+url.QueryEscape(c.Request().RequestURI))
 			}
-			return []byte(viper.GetString("JWT_SECRET")), nil
-		})
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "token expired"})
+		}
 
 		if err != nil {
-			log.Println("Error: Failed to parse JWT token -", err)
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
 		}
 
-		// Extract claims from token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			log.Println("Error: Invalid token claims")
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token claims"})
+		// Held back for CheckAccess, so a route without a privilege check
+		// never sees the token's user
+		if principal.ViaAPIToken() {
+			c.Set(apiTokenKey, principal)
+			return next(c)
 		}
 
-		userID, ok := claims["userid"].(string)
-		if !ok {
-			log.Println("Error: userid missing in token claims")
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id missing in token"})
-		}
+		c.Set(principalKey, principal)
+		return next(c)
+	}
+}
 
-		// Retrieve the stored token from Redis
-		redisClient := db.GetRedisClient()
-		storedToken, err := redisClient.Get("jwt:" + userID).Result()
+// OptionalAuth is AuthMiddleware for pages anyone may see: a caller with
+// valid credentials gets a Principal, anyone else continues anonymously.
+// API tokens count as anonymous.
+func OptionalAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if principal, _, err := authenticate(c, false); err == nil && !principal.ViaAPIToken() {
+			c.Set(principalKey, principal)
+		}
+		return next(c)
+	}
+}
 
-		if err == redis.Nil {
-			log.Println("Error: Token not found in Redis")
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "token expired or not found"})
-		} else if err != nil {
-			log.Println("Error: Redis error -", err)
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to verify token"})
+// SessionAuth is AuthMiddleware for account and security routes, which only
+// a login session may use. Personal access tokens are refused whatever their
+// scopes, so a token never reaches more than its scopes allow.
+func SessionAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return AuthMiddleware(func(c echo.Context) error {
+		if _, ok := c.Get(apiTokenKey).(*Principal); ok {
+			log.Println("API token refused on a session-only route:", c.Path())
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "API tokens can't be used here, log in instead"})
 		}
+		return next(c)
+	})
+}
 
-		// Compare the token from Redis with the provided token
-		if tokenString != storedToken {
-			log.Println("Error: Token mismatch")
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+// LogoutAuth is SessionAuth for logging out. Ending a session doesn't need a
+// fresh access token, so one that has expired is accepted as long as its
+// session is still live.
+func LogoutAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, _, err := authenticate(c, true)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+		}
+		if principal.ViaAPIToken() {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "API tokens can't be used here, log in instead"})
 		}
 
-		// Set claims in context for next middleware/handler
-		c.Set("user", claims)
+		c.Set(principalKey, principal)
 		return next(c)
 	}
 }
+
+// authenticate resolves the caller of a request and reports whether their
+// credential came from the cookie. allowExpired accepts access tokens past
+// their expiry.
+func authenticate(c echo.Context, allowExpired bool) (*Principal, bool, error) {
+	tokenString, fromCookie := requestToken(c)
+	if tokenString == "" {
+		log.Println("Error: Authorization token missing from headers and cookies")
+		return nil, fromCookie, errMissingToken
+	}
+
+	// API tokens are only accepted in the Authorization header
+	if !fromCookie && strings.HasPrefix(tokenString, db.APITokenPrefix) {
+		principal, err := apiTokenAuth(tokenString)
+		return principal, false, err
+	}
+
+	// Parse and verify JWT token and its registered claims
+	parse := auth.ParseToken
+	if allowExpired {
+		parse = auth.ParseExpiredToken
+	}
+	claims, err := parse(tokenString)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, fromCookie, err
+	}
+	if err != nil {
+		log.Println("Error: Failed to parse JWT token -", err)
+		return nil, fromCookie, errInvalidToken
+	}
+
+	// The token must belong to a live session of the user
+	session, err := db.GetSession(claims.SessionID)
+	if err != nil || session.Userid != claims.Userid {
+		log.Println("Error: Session not found or revoked")
+		return nil, fromCookie, errNoSession
+	}
+
+	if err := db.TouchSession(session); err != nil {
+		log.Println("Error: Failed to update session -", err)
+	}
+
+	return &Principal{
+		Userid:    claims.Userid,
+		Email:     claims.Email,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+		Method:    AuthSession,
+	}, fromCookie, nil
+}
+
+// apiTokenAuth authenticates a request made with a personal access token.
+// The token's scopes go in the Principal for CheckAccess to enforce.
+func apiTokenAuth(secret string) (*Principal, error) {
+	token, err := db.GetAPIToken(secret)
+	if err != nil {
+		log.Println("Error: API token not found or revoked")
+		return nil, errInvalidToken
+	}
+
+	if err := db.TouchAPIToken(secret, token); err != nil {
+		log.Println("Error: Failed to update API token -", err)
+	}
+
+	return &Principal{
+		Userid:  token.Userid,
+		Email:   token.Email,
+		TokenID: token.ID,
+		Scopes:  token.Scopes,
+		Method:  AuthAPIToken,
+	}, nil
+}
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"rethink/api/repo"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 )
 
@@ -13,22 +12,29 @@ import (
 func CheckAccess(db *repo.UserController, requiredPermission string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// Retrieve claims from the context
-			userClaims, ok := c.Get("user").(jwt.MapClaims)
+			// Retrieve the caller from the context
+			principal, ok := CurrentPrincipal(c)
 			if !ok {
-				log.Println("JWT Token missing from context")
-				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "token not found in context"})
+				// API tokens are limited to their scopes on top of the user's role
+				token, isToken := c.Get(apiTokenKey).(*Principal)
+				if !isToken {
+					log.Println("Principal missing from context")
+					return c.JSON(http.StatusUnauthorized, echo.Map{"error": "token not found in context"})
+				}
+				if !token.HasScope(requiredPermission) {
+					log.Println("API token lacks scope:", requiredPermission)
+					return c.JSON(http.StatusForbidden, echo.Map{"error": "token scope does not allow this"})
+				}
+				principal = token
 			}
 
-			// Extract email (assuming email is used as a unique identifier)
-			email, ok := userClaims["email"].(string)
-			if !ok {
+			if principal.Email == "" {
 				log.Println("Email missing in token claims")
 				return c.JSON(http.StatusForbidden, echo.Map{"error": "email missing in token"})
 			}
 
-			// Retrieve user role from RethinkDB
-			role, err := db.GetUserRoleByEmail(email)
+			// Retrieve user role from RethinkDB; the one in the token may be stale
+			role, err := db.GetUserRoleByEmail(principal.Email)
 			if err != nil {
 				log.Println("Error fetching role from DB:", err)
 				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch role"})
@@ -49,6 +55,7 @@ func CheckAccess(db *repo.UserController, requiredPermission string) echo.Middle
 				return c.JSON(http.StatusForbidden, echo.Map{"error": "access denied"})
 			}
 
+			c.Set(principalKey, principal)
 			return next(c)
 		}
 	}
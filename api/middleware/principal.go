@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// How a request was authenticated
+const (
+	AuthSession  = "session"   // access token of a login session
+	AuthAPIToken = "api_token" // personal access token
+)
+
+// principalKey is the context key AuthMiddleware stores the Principal under
+const principalKey = "principal"
+
+// apiTokenKey holds the Principal of an API token until CheckAccess has
+// checked its scopes
+const apiTokenKey = "apitoken"
+
+// Principal is who made an authenticated request
+type Principal struct {
+	Userid    string
+	Email     string
+	Role      string // role in the access token; empty for API tokens
+	SessionID string // login session, only for AuthSession
+	TokenID   string // API token, only for AuthAPIToken
+	Scopes    []string
+	Method    string
+}
+
+// ViaAPIToken reports whether the request was made with a personal access token
+func (p *Principal) ViaAPIToken() bool {
+	return p.Method == AuthAPIToken
+}
+
+// HasScope reports whether an API token's scopes include the privilege
+func (p *Principal) HasScope(privilege string) bool {
+	for _, scope := range p.Scopes {
+		if scope == privilege {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentPrincipal returns the authenticated caller, which AuthMiddleware
+// puts in the context
+func CurrentPrincipal(c echo.Context) (*Principal, bool) {
+	p, ok := c.Get(principalKey).(*Principal)
+	return p, ok && p != nil && p.Userid != ""
+}
+
+// requestToken finds the request's credential: a Bearer token in the
+// Authorization header, else the Authorization cookie browsers hold
+func requestToken(c echo.Context) (token string, fromCookie bool) {
+	if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return "", false
+		}
+		return strings.TrimSpace(token), false
+	}
+
+	cookie, err := c.Cookie("Authorization")
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimPrefix(cookie.Value, "Bearer "), true
+}
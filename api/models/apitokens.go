@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// APIToken is a named personal access token for scripts and CI jobs. Only a
+// hash of the token is stored; Prefix is kept so users can tell them apart.
+type APIToken struct {
+	ID        string    ` json:"id" `
+	Userid    string    ` json:"userid" `
+	Email     string    ` json:"email" `
+	Name      string    ` json:"name" `
+	Prefix    string    ` json:"prefix" `
+	Scopes    []string  ` json:"scopes" `
+	CreatedAt time.Time ` json:"createdat" `
+	ExpiresAt time.Time ` json:"expiresat" `
+	LastUsed  time.Time ` json:"lastused" `
+}
@@ -18,11 +18,20 @@ type AppUser struct {
 	Details   string    ` json:"details,omitempty" rethink:"details" `
 	Password  string    ` json:"password" rethinkdb:"password" `
 	Active    bool      ` json:"active" rethinkdb:"active" `
+	Disabled  bool      ` json:"disabled" rethinkdb:"disabled" `
 	Role      string    ` json:"role" rethinkdb:"role" `
 	Dob       time.Time ` json:"dob" rethinkdb:"dob" `
 	Gender    string    ` json:"gender" rethinkdb:"gender" `
 	Email     string    ` json:"email" rethinkdb:"email" `
+	Verified  bool      ` json:"emailverified" rethinkdb:"emailverified" `
 	Phone     string    ` json:"phone" rethinkdb:"phone" `
 	CreatedAt time.Time ` json:"createdat" rethinkdb:"createdat" `
 	UpdatedAt time.Time ` json:"updatedat" rethinkdb:"updatedat" `
+
+	// Two-factor authentication. The secret is encrypted and the recovery
+	// codes hashed; none of it leaves the server.
+	TOTPEnabled   bool     ` json:"totpenabled" rethinkdb:"totpenabled" `
+	TOTPSecret    string   ` json:"-" rethinkdb:"totpsecret" `
+	TOTPLastStep  int64    ` json:"-" rethinkdb:"totplaststep" `
+	RecoveryCodes []string ` json:"-" rethinkdb:"recoverycodes" `
 }
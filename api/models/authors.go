@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type Author struct {
+	ID        string    ` json:"id" rethinkdb:"id,omitempty" `
+	Name      string    ` json:"name" rethinkdb:"name" `
+	Bio       string    ` json:"bio,omitempty" rethinkdb:"bio" `
+	BirthYear int       ` json:"birthyear,omitempty" rethinkdb:"birthyear" `
+	CreatedAt time.Time ` json:"createdat" rethinkdb:"createdat" `
+	UpdatedAt time.Time ` json:"updatedat" rethinkdb:"updatedat" `
+}
+
+func (Author) TableName() string {
+	return "authors"
+}
@@ -10,6 +10,14 @@ type Books struct {
 	CreatedAt   time.Time ` json:"createdat" rethink:"createdat" `
 	UpdatedBy   string    ` json:"updatedby" rethink:"updatedby" `
 	UpdatedAt   time.Time ` json:"updatedat" rethink:"updatedat" `
+	RatingAvg   float64   ` json:"ratingavg" rethink:"ratingavg" `
+	RatingCount int       ` json:"ratingcount" rethink:"ratingcount" `
+	AuthorIDs   []string  ` json:"authorids" rethink:"authorids" `
+
+	// Authors and the copy counts are filled in by joined reads and never written back
+	Authors         []Author ` json:"authors,omitempty" rethinkdb:"authors,omitempty" `
+	TotalCopies     int      ` json:"totalcopies" rethinkdb:"totalcopies,omitempty" `
+	AvailableCopies int      ` json:"availablecopies" rethinkdb:"availablecopies,omitempty" `
 }
 
 func (Books) TableName() string {
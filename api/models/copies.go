@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Copy statuses
+const (
+	CopyAvailable = "available"
+	CopyOnLoan    = "on_loan"
+	CopyInRepair  = "in_repair"
+	CopyLost      = "lost"
+	CopyWithdrawn = "withdrawn"
+)
+
+// CopyStatuses lists every valid copy status
+var CopyStatuses = []string{CopyAvailable, CopyOnLoan, CopyInRepair, CopyLost, CopyWithdrawn}
+
+type Copy struct {
+	ID         string    ` json:"id" rethinkdb:"id,omitempty" `
+	BookID     int       ` json:"bookid" rethinkdb:"bookid" `
+	Barcode    string    ` json:"barcode" rethinkdb:"barcode" `
+	Location   string    ` json:"location" rethinkdb:"location" `
+	Condition  string    ` json:"condition" rethinkdb:"condition" `
+	AcquiredAt time.Time ` json:"acquiredat" rethinkdb:"acquiredat" `
+	Status     string    ` json:"status" rethinkdb:"status" `
+	CreatedAt  time.Time ` json:"createdat" rethinkdb:"createdat" `
+	UpdatedAt  time.Time ` json:"updatedat" rethinkdb:"updatedat" `
+}
+
+func (Copy) TableName() string {
+	return "copies"
+}
+
+// CopyAudit records a change of a copy's status
+type CopyAudit struct {
+	ID        string    ` json:"id" rethinkdb:"id,omitempty" `
+	CopyID    string    ` json:"copyid" rethinkdb:"copyid" `
+	BookID    int       ` json:"bookid" rethinkdb:"bookid" `
+	Barcode   string    ` json:"barcode" rethinkdb:"barcode" `
+	OldStatus string    ` json:"oldstatus" rethinkdb:"oldstatus" `
+	NewStatus string    ` json:"newstatus" rethinkdb:"newstatus" `
+	Note      string    ` json:"note,omitempty" rethinkdb:"note" `
+	ChangedBy string    ` json:"changedby" rethinkdb:"changedby" `
+	ChangedAt time.Time ` json:"changedat" rethinkdb:"changedat" `
+}
+
+func (CopyAudit) TableName() string {
+	return "copy_audit"
+}
+
+// ValidCopyStatus reports whether status is one of CopyStatuses
+func ValidCopyStatus(status string) bool {
+	for _, s := range CopyStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
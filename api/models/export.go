@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Export job statuses
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// ExportJob tracks the asynchronous generation of a personal data export
+type ExportJob struct {
+	ID          string    ` json:"id" `
+	Userid      string    ` json:"userid" `
+	Status      string    ` json:"status" `
+	Error       string    ` json:"error,omitempty" `
+	CreatedAt   time.Time ` json:"createdat" `
+	CompletedAt time.Time ` json:"completedat,omitempty" `
+	DownloadURL string    ` json:"downloadurl,omitempty" `
+}
+
+// UserExport is everything stored about a user
+type UserExport struct {
+	User         AppUser       ` json:"user" `
+	Books        []Books       ` json:"books" `
+	Reviews      []Review      ` json:"reviews" `
+	ReadingLists []ReadingList ` json:"readinglists" `
+	Sessions     []Session     ` json:"sessions" `
+	UserAudit    []UserAudit   ` json:"useraudit" `
+	CopyAudit    []CopyAudit   ` json:"copyaudit" `
+}
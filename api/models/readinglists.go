@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type ReadingList struct {
+	ID         string    ` json:"id" rethinkdb:"id,omitempty" `
+	Userid     string    ` json:"userid" rethinkdb:"userid" `
+	Name       string    ` json:"name" rethinkdb:"name" `
+	BookIDs    []int     ` json:"bookids" rethinkdb:"bookids" `
+	Shared     bool      ` json:"shared" rethinkdb:"shared" `
+	ShareToken string    ` json:"sharetoken,omitempty" rethinkdb:"sharetoken" `
+	CreatedAt  time.Time ` json:"createdat" rethinkdb:"createdat" `
+	UpdatedAt  time.Time ` json:"updatedat" rethinkdb:"updatedat" `
+}
+
+func (ReadingList) TableName() string {
+	return "reading_lists"
+}
+
+// SharedReadingList is what holders of a share link see of a list. It leaves
+// out the owner and the share token.
+type SharedReadingList struct {
+	Name      string    ` json:"name" `
+	BookIDs   []int     ` json:"bookids" `
+	Books     []Books   ` json:"books" `
+	UpdatedAt time.Time ` json:"updatedat" `
+}
+
+// PublicView returns the public view of the list with the details of its books
+func (l ReadingList) PublicView(books []Books) SharedReadingList {
+	return SharedReadingList{
+		Name:      l.Name,
+		BookIDs:   l.BookIDs,
+		Books:     books,
+		UpdatedAt: l.UpdatedAt,
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type Review struct {
+	ID        string    ` json:"id" rethinkdb:"id" `
+	BookID    int       ` json:"bookid" rethinkdb:"bookid" `
+	Userid    string    ` json:"userid" rethinkdb:"userid" `
+	Rating    int       ` json:"rating" rethinkdb:"rating" `
+	Text      string    ` json:"text" rethinkdb:"text" `
+	Hidden    bool      ` json:"hidden" rethinkdb:"hidden" `
+	CreatedAt time.Time ` json:"createdat" rethinkdb:"createdat" `
+	UpdatedAt time.Time ` json:"updatedat" rethinkdb:"updatedat" `
+}
+
+func (Review) TableName() string {
+	return "reviews"
+}
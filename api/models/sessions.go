@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is one logged in device of a user. Its ID is carried in the
+// token's "sid" claim; the token itself is never stored.
+type Session struct {
+	ID        string    ` json:"id" `
+	Userid    string    ` json:"userid" `
+	UserAgent string    ` json:"useragent" `
+	IP        string    ` json:"ip" `
+	CreatedAt time.Time ` json:"createdat" `
+	LastSeen  time.Time ` json:"lastseen" `
+	ExpiresAt time.Time ` json:"expiresat" `
+}
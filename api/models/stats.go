@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+type MonthCount struct {
+	Month string ` json:"month" `
+	Count int    ` json:"count" `
+}
+
+type Contributor struct {
+	Userid string ` json:"userid" rethinkdb:"userid" `
+	Name   string ` json:"name" rethinkdb:"name" `
+	Count  int    ` json:"count" rethinkdb:"count" `
+}
+
+type RoleCount struct {
+	Role  string ` json:"role" rethinkdb:"group" `
+	Count int    ` json:"count" rethinkdb:"reduction" `
+}
+
+type Stats struct {
+	From            *time.Time    ` json:"from,omitempty" `
+	To              *time.Time    ` json:"to,omitempty" `
+	TotalBooks      int           ` json:"totalbooks" `
+	BooksPerMonth   []MonthCount  ` json:"bookspermonth" `
+	TopContributors []Contributor ` json:"topcontributors" `
+	UsersByRole     []RoleCount   ` json:"usersbyrole" `
+	ActiveUsers     int           ` json:"activeusers" `
+	InactiveUsers   int           ` json:"inactiveusers" `
+	RecentlyUpdated []Books       ` json:"recentlyupdated" `
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// What happens to the books of a deleted user
+const (
+	// BooksAnonymize replaces the user on their books with DeletedUser
+	BooksAnonymize = "anonymize"
+	// BooksTransfer hands their books over to another user
+	BooksTransfer = "transfer"
+)
+
+// DeletedUser stands in for the creator of books whose authorship was anonymized
+const DeletedUser = "deleted-user"
+
+// UserAudit records an account-level action such as a deletion
+type UserAudit struct {
+	ID          string    ` json:"id" rethinkdb:"id,omitempty" `
+	Userid      string    ` json:"userid" rethinkdb:"userid" `
+	Email       string    ` json:"email" rethinkdb:"email" `
+	Action      string    ` json:"action" rethinkdb:"action" `
+	Detail      string    ` json:"detail,omitempty" rethinkdb:"detail" `
+	PerformedBy string    ` json:"performedby" rethinkdb:"performedby" `
+	At          time.Time ` json:"at" rethinkdb:"at" `
+}
+
+func (UserAudit) TableName() string {
+	return "user_audit"
+}
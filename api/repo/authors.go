@@ -0,0 +1,218 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"rethink/api/models"
+	"time"
+
+	r "github.com/rethinkdb/rethinkdb-go"
+)
+
+// AuthorController struct handles database interactions for authors
+type AuthorController struct {
+	Session *r.Session
+}
+
+// NewAuthorController initializes the AuthorController with a RethinkDB session
+func NewAuthorController(Session *r.Session) *AuthorController {
+	return &AuthorController{Session: Session}
+}
+
+// withAuthors joins a book with the author documents its AuthorIDs point to
+func withAuthors(book r.Term) interface{} {
+	return map[string]interface{}{
+		"authors": book.Field("AuthorIDs").Default([]string{}).
+			Map(func(id r.Term) interface{} {
+				return r.Table("authors").Get(id)
+			}).
+			Filter(func(author r.Term) interface{} {
+				return author.Ne(nil)
+			}),
+	}
+}
+
+// GetAuthors retrieves all authors ordered by name
+func (ac *AuthorController) GetAuthors() ([]models.Author, error) {
+
+	cursor, err := r.Table("authors").OrderBy(r.Asc("name")).Run(ac.Session)
+	if err != nil {
+		log.Println("Error fetching authors:", err)
+		return nil, err
+	}
+	defer cursor.Close()
+
+	authors := []models.Author{}
+	if err := cursor.All(&authors); err != nil {
+		log.Println("Error parsing authors:", err)
+		return nil, err
+	}
+
+	return authors, nil
+}
+
+// GetAuthor retrieves a single author by ID
+func (ac *AuthorController) GetAuthor(ID string) (*models.Author, error) {
+
+	cursor, err := r.Table("authors").Get(ID).Run(ac.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, errors.New("author not found")
+	}
+
+	var author models.Author
+	if err := cursor.One(&author); err != nil {
+		return nil, err
+	}
+
+	return &author, nil
+}
+
+// GetAuthorBooks retrieves the books written by an author, with all their authors joined
+func (ac *AuthorController) GetAuthorBooks(ID string) ([]models.Books, error) {
+
+	cursor, err := r.Table("books").
+		Filter(r.Row.Field("AuthorIDs").Default([]string{}).Contains(ID)).
+		Merge(withAuthors).
+		OrderBy(r.Asc("Title")).
+		Run(ac.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	books := []models.Books{}
+	if err := cursor.All(&books); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// CheckAuthors makes sure every ID refers to an existing author
+func (ac *AuthorController) CheckAuthors(IDs []string) error {
+
+	for _, ID := range IDs {
+		if _, err := ac.GetAuthor(ID); err != nil {
+			return errors.New("unknown author ID: " + ID)
+		}
+	}
+
+	return nil
+}
+
+// CreateAuthor adds a new author to the database
+func (ac *AuthorController) CreateAuthor(author models.Author) (*models.Author, error) {
+
+	if author.Name == "" {
+		return nil, errors.New("author name is required")
+	}
+
+	author.ID = ""
+	author.CreatedAt = time.Now()
+	author.UpdatedAt = time.Now()
+
+	res, err := r.Table("authors").Insert(author).RunWrite(ac.Session)
+	if err != nil {
+		log.Println("Error inserting author:", err)
+		return nil, err
+	}
+	if res.Inserted == 0 || len(res.GeneratedKeys) == 0 {
+		return nil, errors.New("failed to insert author")
+	}
+
+	author.ID = res.GeneratedKeys[0]
+	return &author, nil
+}
+
+// UpdateAuthor updates an existing author's details
+func (ac *AuthorController) UpdateAuthor(ID string, updated models.Author) (*models.Author, error) {
+
+	existing, err := ac.GetAuthor(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.Name == "" {
+		return nil, errors.New("author name is required")
+	}
+
+	updated.ID = existing.ID
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = time.Now()
+
+	_, err = r.Table("authors").Get(ID).Replace(updated).RunWrite(ac.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// DeleteAuthor removes an author. Authors still credited on books can't be
+// deleted; merge them into another author instead.
+func (ac *AuthorController) DeleteAuthor(ID string) error {
+
+	books, err := ac.GetAuthorBooks(ID)
+	if err != nil {
+		return err
+	}
+	if len(books) > 0 {
+		return errors.New("author is credited on books, merge it into another author instead")
+	}
+
+	res, err := r.Table("authors").Get(ID).Delete().RunWrite(ac.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted == 0 {
+		return errors.New("author not found or already deleted")
+	}
+
+	return nil
+}
+
+// MergeAuthors folds a duplicate author into the one being kept: every book
+// crediting the duplicate is moved over to the kept author and the duplicate
+// is deleted
+func (ac *AuthorController) MergeAuthors(KeepID, DuplicateID string) error {
+
+	if KeepID == DuplicateID {
+		return errors.New("cannot merge an author into itself")
+	}
+
+	if _, err := ac.GetAuthor(KeepID); err != nil {
+		return err
+	}
+	if _, err := ac.GetAuthor(DuplicateID); err != nil {
+		return err
+	}
+
+	_, err := r.Table("books").
+		Filter(r.Row.Field("AuthorIDs").Default([]string{}).Contains(DuplicateID)).
+		Update(func(book r.Term) interface{} {
+			ids := book.Field("AuthorIDs")
+			return map[string]interface{}{
+				"AuthorIDs": r.Branch(
+					ids.Contains(KeepID),
+					ids.Difference([]string{DuplicateID}),
+					ids.Map(func(id r.Term) interface{} {
+						return r.Branch(id.Eq(DuplicateID), KeepID, id)
+					}),
+				),
+			}
+		}).
+		RunWrite(ac.Session)
+	if err != nil {
+		log.Println("Error moving books to merged author:", err)
+		return err
+	}
+
+	_, err = r.Table("authors").Get(DuplicateID).Delete().RunWrite(ac.Session)
+	return err
+}
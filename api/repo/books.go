@@ -21,11 +21,22 @@ func NewBookController(Session *r.Session) *BookController {
 
 // Getbooks retrieves all books from the database
 func (bc *BookController) GetBooks() ([]models.Books, error) {
+	return bc.GetBooksSorted("")
+}
+
+// GetBooksSorted retrieves all books ordered by the given key. "rating" sorts
+// by highest average rating first; anything else keeps the table order.
+func (bc *BookController) GetBooksSorted(sortBy string) ([]models.Books, error) {
 
 	log.Println("Fetching Books from DB...")
 	var books []models.Books
 
-	cursor, err := r.Table("books").Run(bc.Session)
+	query := r.Table("books").Merge(withAuthors).Merge(withAvailability)
+	if sortBy == "rating" {
+		query = query.OrderBy(r.Desc("RatingAvg"), r.Desc("RatingCount"), r.Asc("BookID"))
+	}
+
+	cursor, err := query.Run(bc.Session)
 	if err != nil {
 		log.Println("Error Fetching Books:", err)
 		return nil, err
@@ -46,7 +57,7 @@ func (bc *BookController) GetBooks() ([]models.Books, error) {
 func (bc *BookController) GetBook(BookID int) (*models.Books, error) {
 
 	var book models.Books
-	cursor, err := r.Table("books").Filter(r.Row.Field("BookID").Eq(BookID)).Run(bc.Session)
+	cursor, err := r.Table("books").Filter(r.Row.Field("BookID").Eq(BookID)).Merge(withAuthors).Merge(withAvailability).Run(bc.Session)
 	if err != nil {
 		return nil, err
 	}
@@ -107,5 +118,28 @@ func (bc *BookController) DeleteBook(BookID int) error {
 		return errors.New("book not found or already deleted")
 	}
 
+	// Reviews of a deleted book have nothing left to rate
+	_, err = r.Table("reviews").Filter(r.Row.Field("bookid").Eq(BookID)).Delete().RunWrite(bc.Session)
+	if err != nil {
+		log.Println("Error deleting reviews of book:", err)
+	}
+
+	// Physical copies go with the title; their audit trail is kept
+	_, err = r.Table("copies").GetAllByIndex("bookid", BookID).Delete().RunWrite(bc.Session)
+	if err != nil {
+		log.Println("Error deleting copies of book:", err)
+	}
+
+	// Take the book off every reading list it was on
+	_, err = r.Table("reading_lists").
+		Filter(r.Row.Field("bookids").Contains(BookID)).
+		Update(func(list r.Term) interface{} {
+			return map[string]interface{}{"bookids": list.Field("bookids").Difference([]int{BookID})}
+		}).
+		RunWrite(bc.Session)
+	if err != nil {
+		log.Println("Error removing book from reading lists:", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,265 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"rethink/api/models"
+	"time"
+
+	r "github.com/rethinkdb/rethinkdb-go"
+)
+
+// CopyController struct handles database interactions for physical copies
+type CopyController struct {
+	Session *r.Session
+}
+
+// NewCopyController initializes the CopyController with a RethinkDB session
+func NewCopyController(Session *r.Session) *CopyController {
+	return &CopyController{Session: Session}
+}
+
+// withAvailability joins a book with the number of its copies, in total and available
+func withAvailability(book r.Term) interface{} {
+	copies := r.Table("copies").GetAllByIndex("bookid", book.Field("BookID"))
+	return map[string]interface{}{
+		"totalcopies": copies.Count(),
+		"availablecopies": copies.Filter(func(c r.Term) interface{} {
+			return c.Field("status").Eq(models.CopyAvailable)
+		}).Count(),
+	}
+}
+
+// GetCopies retrieves the copies of a book ordered by barcode
+func (cc *CopyController) GetCopies(BookID int) ([]models.Copy, error) {
+
+	cursor, err := r.Table("copies").
+		GetAllByIndex("bookid", BookID).
+		OrderBy(r.Asc("barcode")).
+		Run(cc.Session)
+	if err != nil {
+		log.Println("Error fetching copies:", err)
+		return nil, err
+	}
+	defer cursor.Close()
+
+	copies := []models.Copy{}
+	if err := cursor.All(&copies); err != nil {
+		log.Println("Error parsing copies:", err)
+		return nil, err
+	}
+
+	return copies, nil
+}
+
+// GetCopy retrieves a single copy by ID
+func (cc *CopyController) GetCopy(ID string) (*models.Copy, error) {
+
+	cursor, err := r.Table("copies").Get(ID).Run(cc.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, errors.New("copy not found")
+	}
+
+	var bookCopy models.Copy
+	if err := cursor.One(&bookCopy); err != nil {
+		return nil, err
+	}
+
+	return &bookCopy, nil
+}
+
+// barcodeTaken reports whether another copy already uses the barcode
+func (cc *CopyController) barcodeTaken(Barcode, exceptID string) (bool, error) {
+
+	cursor, err := r.Table("copies").
+		Filter(r.Row.Field("barcode").Eq(Barcode).And(r.Row.Field("id").Ne(exceptID))).
+		Count().
+		Run(cc.Session)
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close()
+
+	var count int
+	if cursor.Next(&count) && count > 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// validate checks the fields shared by create and update
+func (cc *CopyController) validate(bookCopy models.Copy, exceptID string) error {
+
+	if bookCopy.Barcode == "" {
+		return errors.New("barcode is required")
+	}
+	if !models.ValidCopyStatus(bookCopy.Status) {
+		return errors.New("invalid copy status")
+	}
+
+	taken, err := cc.barcodeTaken(bookCopy.Barcode, exceptID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.New("barcode already in use")
+	}
+
+	return nil
+}
+
+// CreateCopy adds a new copy of a book and audits its initial status
+func (cc *CopyController) CreateCopy(bookCopy models.Copy, changedBy string) (*models.Copy, error) {
+
+	if bookCopy.Status == "" {
+		bookCopy.Status = models.CopyAvailable
+	}
+	if err := cc.validate(bookCopy, ""); err != nil {
+		return nil, err
+	}
+
+	bookCopy.ID = ""
+	bookCopy.CreatedAt = time.Now()
+	bookCopy.UpdatedAt = time.Now()
+
+	res, err := r.Table("copies").Insert(bookCopy).RunWrite(cc.Session)
+	if err != nil {
+		log.Println("Error inserting copy:", err)
+		return nil, err
+	}
+	if res.Inserted == 0 || len(res.GeneratedKeys) == 0 {
+		return nil, errors.New("failed to insert copy")
+	}
+	bookCopy.ID = res.GeneratedKeys[0]
+
+	cc.audit(bookCopy, "", bookCopy.Status, changedBy, "copy added")
+	return &bookCopy, nil
+}
+
+// UpdateCopy replaces a copy's details, auditing a change of status
+func (cc *CopyController) UpdateCopy(ID string, updated models.Copy, changedBy string) (*models.Copy, error) {
+
+	existing, err := cc.GetCopy(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.Status == "" {
+		updated.Status = existing.Status
+	}
+	if err := cc.validate(updated, ID); err != nil {
+		return nil, err
+	}
+
+	updated.ID = existing.ID
+	updated.BookID = existing.BookID
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = time.Now()
+
+	_, err = r.Table("copies").Get(ID).Replace(updated).RunWrite(cc.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.Status != existing.Status {
+		cc.audit(updated, existing.Status, updated.Status, changedBy, "")
+	}
+
+	return &updated, nil
+}
+
+// SetStatus changes a copy's status and audits the change
+func (cc *CopyController) SetStatus(ID, status, changedBy, note string) (*models.Copy, error) {
+
+	if !models.ValidCopyStatus(status) {
+		return nil, errors.New("invalid copy status")
+	}
+
+	bookCopy, err := cc.GetCopy(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if bookCopy.Status == status {
+		return bookCopy, nil
+	}
+
+	_, err = r.Table("copies").Get(ID).
+		Update(map[string]interface{}{"status": status, "updatedat": time.Now()}).
+		RunWrite(cc.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	oldStatus := bookCopy.Status
+	bookCopy.Status = status
+	cc.audit(*bookCopy, oldStatus, status, changedBy, note)
+
+	return bookCopy, nil
+}
+
+// DeleteCopy removes a copy, keeping its audit trail
+func (cc *CopyController) DeleteCopy(ID, changedBy string) error {
+
+	bookCopy, err := cc.GetCopy(ID)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.Table("copies").Get(ID).Delete().RunWrite(cc.Session)
+	if err != nil {
+		return err
+	}
+	if res.Deleted == 0 {
+		return errors.New("copy not found or already deleted")
+	}
+
+	cc.audit(*bookCopy, bookCopy.Status, "", changedBy, "copy removed")
+	return nil
+}
+
+// GetCopyAudit retrieves the status history of a copy, newest first
+func (cc *CopyController) GetCopyAudit(ID string) ([]models.CopyAudit, error) {
+
+	cursor, err := r.Table("copy_audit").
+		Filter(r.Row.Field("copyid").Eq(ID)).
+		OrderBy(r.Desc("changedat")).
+		Run(cc.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	entries := []models.CopyAudit{}
+	if err := cursor.All(&entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// audit writes a status change to the copy audit trail. Failures are logged
+// rather than returned since the change itself has already been stored.
+func (cc *CopyController) audit(bookCopy models.Copy, oldStatus, newStatus, changedBy, note string) {
+
+	entry := models.CopyAudit{
+		CopyID:    bookCopy.ID,
+		BookID:    bookCopy.BookID,
+		Barcode:   bookCopy.Barcode,
+		OldStatus: oldStatus,
+		NewStatus: newStatus,
+		Note:      note,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	}
+
+	if _, err := r.Table("copy_audit").Insert(entry).RunWrite(cc.Session); err != nil {
+		log.Println("Error writing copy audit entry:", err)
+	}
+}
@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"log"
+	"rethink/api/models"
+
+	r "github.com/rethinkdb/rethinkdb-go"
+)
+
+// ExportController struct gathers a user's data for personal data exports
+type ExportController struct {
+	Session *r.Session
+}
+
+// NewExportController initializes the ExportController with a RethinkDB session
+func NewExportController(Session *r.Session) *ExportController {
+	return &ExportController{Session: Session}
+}
+
+// GetUserData collects the user's record, without the password hash, the books
+// they created or updated, their reviews and reading lists and the audit
+// entries about them. Sessions live in the session store and are added by
+// the caller.
+func (ec *ExportController) GetUserData(Userid string) (*models.UserExport, error) {
+	data := &models.UserExport{
+		Books:        []models.Books{},
+		Reviews:      []models.Review{},
+		ReadingLists: []models.ReadingList{},
+		Sessions:     []models.Session{},
+		UserAudit:    []models.UserAudit{},
+		CopyAudit:    []models.CopyAudit{},
+	}
+
+	if err := r.Table("users").Filter(r.Row.Field("userid").Eq(Userid)).ReadOne(&data.User, ec.Session); err != nil {
+		log.Println("Error fetching user for export:", err)
+		return nil, err
+	}
+	data.User.Password = ""
+
+	// Books are stored under the Go field names of models.Books
+	books := r.Table("books").
+		Filter(r.Row.Field("CreatedBy").Eq(Userid).Or(r.Row.Field("UpdatedBy").Eq(Userid))).
+		OrderBy(r.Asc("BookID"))
+
+	queries := []struct {
+		query r.Term
+		dest  interface{}
+	}{
+		{books, &data.Books},
+		{r.Table("reviews").Filter(r.Row.Field("userid").Eq(Userid)).OrderBy(r.Asc("createdat")), &data.Reviews},
+		{r.Table("reading_lists").Filter(r.Row.Field("userid").Eq(Userid)).OrderBy(r.Asc("createdat")), &data.ReadingLists},
+		{r.Table("user_audit").Filter(r.Row.Field("userid").Eq(Userid)).OrderBy(r.Asc("at")), &data.UserAudit},
+		{r.Table("copy_audit").Filter(r.Row.Field("changedby").Eq(Userid)).OrderBy(r.Asc("changedat")), &data.CopyAudit},
+	}
+
+	for _, q := range queries {
+		if err := q.query.ReadAll(q.dest, ec.Session); err != nil {
+			log.Println("Error fetching data for export:", err)
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
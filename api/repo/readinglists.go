@@ -0,0 +1,292 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"rethink/api/models"
+	"time"
+
+	"github.com/google/uuid"
+	r "github.com/rethinkdb/rethinkdb-go"
+)
+
+// ListController struct handles database interactions for reading lists
+type ListController struct {
+	Session *r.Session
+}
+
+// NewListController initializes the ListController with a RethinkDB session
+func NewListController(Session *r.Session) *ListController {
+	return &ListController{Session: Session}
+}
+
+// GetLists retrieves all reading lists owned by a user
+func (lc *ListController) GetLists(Userid string) ([]models.ReadingList, error) {
+
+	cursor, err := r.Table("reading_lists").
+		Filter(r.Row.Field("userid").Eq(Userid)).
+		OrderBy(r.Asc("createdat")).
+		Run(lc.Session)
+	if err != nil {
+		log.Println("Error fetching reading lists:", err)
+		return nil, err
+	}
+	defer cursor.Close()
+
+	lists := []models.ReadingList{}
+	if err := cursor.All(&lists); err != nil {
+		log.Println("Error parsing reading lists:", err)
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// GetList retrieves a reading list by ID
+func (lc *ListController) GetList(ID string) (*models.ReadingList, error) {
+
+	cursor, err := r.Table("reading_lists").Get(ID).Run(lc.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, errors.New("reading list not found")
+	}
+
+	var list models.ReadingList
+	if err := cursor.One(&list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// GetUserList retrieves a reading list only if it belongs to the given user
+func (lc *ListController) GetUserList(ID, Userid string) (*models.ReadingList, error) {
+
+	list, err := lc.GetList(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if list.Userid != Userid {
+		return nil, errors.New("reading list not found")
+	}
+
+	return list, nil
+}
+
+// GetSharedList retrieves a shared reading list by its share token
+func (lc *ListController) GetSharedList(ShareToken string) (*models.ReadingList, error) {
+
+	if ShareToken == "" {
+		return nil, errors.New("reading list not found")
+	}
+
+	var list models.ReadingList
+	err := r.Table("reading_lists").
+		Filter(r.Row.Field("sharetoken").Eq(ShareToken).And(r.Row.Field("shared").Eq(true))).
+		ReadOne(&list, lc.Session)
+	if err != nil {
+		return nil, errors.New("reading list not found")
+	}
+
+	return &list, nil
+}
+
+// CreateList adds a new, empty and private reading list for a user
+func (lc *ListController) CreateList(Userid, Name string) (*models.ReadingList, error) {
+
+	if Name == "" {
+		return nil, errors.New("list name is required")
+	}
+
+	list := models.ReadingList{
+		Userid:    Userid,
+		Name:      Name,
+		BookIDs:   []int{},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	res, err := r.Table("reading_lists").Insert(list).RunWrite(lc.Session)
+	if err != nil {
+		log.Println("Error inserting reading list:", err)
+		return nil, err
+	}
+	if res.Inserted == 0 || len(res.GeneratedKeys) == 0 {
+		return nil, errors.New("failed to create reading list")
+	}
+
+	list.ID = res.GeneratedKeys[0]
+	return &list, nil
+}
+
+// RenameList changes the name of a reading list
+func (lc *ListController) RenameList(ID, Name string) error {
+
+	if Name == "" {
+		return errors.New("list name is required")
+	}
+
+	return lc.update(ID, map[string]interface{}{"name": Name})
+}
+
+// SetShared makes a reading list private or shares it with a link. Sharing
+// issues a new token, so re-sharing a list invalidates previously handed out links.
+func (lc *ListController) SetShared(ID string, shared bool) (*models.ReadingList, error) {
+
+	token := ""
+	if shared {
+		token = uuid.New().String()
+	}
+
+	err := lc.update(ID, map[string]interface{}{"shared": shared, "sharetoken": token})
+	if err != nil {
+		return nil, err
+	}
+
+	return lc.GetList(ID)
+}
+
+// AddBook appends a book to the end of a reading list. Adding a book that is
+// already on the list leaves the list unchanged.
+func (lc *ListController) AddBook(ID string, BookID int) error {
+
+	list, err := lc.GetList(ID)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range list.BookIDs {
+		if existing == BookID {
+			return nil
+		}
+	}
+
+	return lc.update(ID, map[string]interface{}{"bookids": r.Row.Field("bookids").Append(BookID)})
+}
+
+// RemoveBook takes a book off a reading list
+func (lc *ListController) RemoveBook(ID string, BookID int) error {
+	return lc.update(ID, map[string]interface{}{"bookids": r.Row.Field("bookids").Difference([]int{BookID})})
+}
+
+// ReorderBooks replaces the order of a reading list. The new order must hold
+// exactly the books already on the list.
+func (lc *ListController) ReorderBooks(ID string, BookIDs []int) error {
+
+	list, err := lc.GetList(ID)
+	if err != nil {
+		return err
+	}
+
+	if len(BookIDs) != len(list.BookIDs) {
+		return errors.New("new order must contain every book on the list")
+	}
+
+	onList := make(map[int]bool, len(list.BookIDs))
+	for _, BookID := range list.BookIDs {
+		onList[BookID] = true
+	}
+	for _, BookID := range BookIDs {
+		if !onList[BookID] {
+			return errors.New("new order must contain every book on the list")
+		}
+		delete(onList, BookID)
+	}
+
+	return lc.update(ID, map[string]interface{}{"bookids": BookIDs})
+}
+
+// MoveBook shifts a book one position up (-1) or down (+1) in a reading list
+func (lc *ListController) MoveBook(ID string, BookID, offset int) error {
+
+	list, err := lc.GetList(ID)
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range list.BookIDs {
+		if existing != BookID {
+			continue
+		}
+		j := i + offset
+		if j < 0 || j >= len(list.BookIDs) {
+			return nil
+		}
+		list.BookIDs[i], list.BookIDs[j] = list.BookIDs[j], list.BookIDs[i]
+		return lc.update(ID, map[string]interface{}{"bookids": list.BookIDs})
+	}
+
+	return errors.New("book is not on the list")
+}
+
+// DeleteList removes a reading list
+func (lc *ListController) DeleteList(ID string) error {
+
+	res, err := r.Table("reading_lists").Get(ID).Delete().RunWrite(lc.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted == 0 {
+		return errors.New("reading list not found or already deleted")
+	}
+
+	return nil
+}
+
+// GetListBooks retrieves the books on a reading list in list order
+func (lc *ListController) GetListBooks(list *models.ReadingList) ([]models.Books, error) {
+
+	books := []models.Books{}
+	if len(list.BookIDs) == 0 {
+		return books, nil
+	}
+
+	cursor, err := r.Table("books").
+		Filter(r.Expr(list.BookIDs).Contains(r.Row.Field("BookID"))).
+		Run(lc.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var found []models.Books
+	if err := cursor.All(&found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]models.Books, len(found))
+	for _, book := range found {
+		byID[book.BookID] = book
+	}
+	for _, BookID := range list.BookIDs {
+		if book, ok := byID[BookID]; ok {
+			books = append(books, book)
+		}
+	}
+
+	return books, nil
+}
+
+// update applies a partial update to a reading list and bumps its UpdatedAt
+func (lc *ListController) update(ID string, fields map[string]interface{}) error {
+
+	fields["updatedat"] = time.Now()
+
+	res, err := r.Table("reading_lists").Get(ID).Update(fields).RunWrite(lc.Session)
+	if err != nil {
+		log.Println("Error updating reading list:", err)
+		return err
+	}
+
+	if res.Replaced == 0 && res.Updated == 0 && res.Unchanged == 0 {
+		return errors.New("reading list not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"rethink/api/models"
+	"time"
+
+	r "github.com/rethinkdb/rethinkdb-go"
+)
+
+// ReviewController struct handles database interactions for book reviews
+type ReviewController struct {
+	Session *r.Session
+}
+
+// NewReviewController initializes the ReviewController with a RethinkDB session
+func NewReviewController(Session *r.Session) *ReviewController {
+	return &ReviewController{Session: Session}
+}
+
+// reviewID builds the document key for a user's review of a book, so a user
+// can only ever hold a single review per book
+func reviewID(BookID int, Userid string) string {
+	return fmt.Sprintf("%d:%s", BookID, Userid)
+}
+
+// GetReviews retrieves the reviews of a book, newest first. Hidden reviews are
+// only included when includeHidden is set.
+func (rc *ReviewController) GetReviews(BookID int, includeHidden bool) ([]models.Review, error) {
+
+	query := r.Table("reviews").Filter(r.Row.Field("bookid").Eq(BookID))
+	if !includeHidden {
+		query = query.Filter(r.Row.Field("hidden").Eq(false))
+	}
+
+	cursor, err := query.OrderBy(r.Desc("updatedat")).Run(rc.Session)
+	if err != nil {
+		log.Println("Error fetching reviews:", err)
+		return nil, err
+	}
+	defer cursor.Close()
+
+	reviews := []models.Review{}
+	if err := cursor.All(&reviews); err != nil {
+		log.Println("Error parsing reviews:", err)
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// GetReview retrieves a single review by its ID
+func (rc *ReviewController) GetReview(ID string) (*models.Review, error) {
+
+	cursor, err := r.Table("reviews").Get(ID).Run(rc.Session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, errors.New("review not found")
+	}
+
+	var review models.Review
+	if err := cursor.One(&review); err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// SaveReview creates the user's review of a book or edits it if one exists,
+// then refreshes the book's rating aggregate
+func (rc *ReviewController) SaveReview(review models.Review) (*models.Review, error) {
+
+	if review.Rating < 1 || review.Rating > 5 {
+		return nil, errors.New("rating must be between 1 and 5")
+	}
+
+	now := time.Now()
+	review.ID = reviewID(review.BookID, review.Userid)
+	review.UpdatedAt = now
+
+	existing, err := rc.GetReview(review.ID)
+	if err == nil {
+		// Keep the original creation time and moderation state on edit
+		review.CreatedAt = existing.CreatedAt
+		review.Hidden = existing.Hidden
+	} else {
+		review.CreatedAt = now
+	}
+
+	_, err = r.Table("reviews").
+		Insert(review, r.InsertOpts{Conflict: "replace"}).
+		RunWrite(rc.Session)
+	if err != nil {
+		log.Println("Error saving review:", err)
+		return nil, err
+	}
+
+	if err := rc.RefreshRating(review.BookID); err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// SetHidden hides or restores a review and refreshes the book's rating aggregate
+func (rc *ReviewController) SetHidden(ID string, hidden bool) error {
+
+	review, err := rc.GetReview(ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Table("reviews").Get(ID).
+		Update(map[string]interface{}{"hidden": hidden}).
+		RunWrite(rc.Session)
+	if err != nil {
+		return err
+	}
+
+	return rc.RefreshRating(review.BookID)
+}
+
+// RefreshRating recomputes a book's rating average and count from its visible
+// reviews. The aggregate is always derived from the reviews table in a single
+// write so concurrent edits can't leave it drifting.
+func (rc *ReviewController) RefreshRating(BookID int) error {
+
+	// An explicit function is used since r.Row can't be nested inside the update
+	visible := r.Table("reviews").
+		Filter(func(review r.Term) r.Term {
+			return review.Field("bookid").Eq(BookID).And(review.Field("hidden").Eq(false))
+		}).
+		Field("rating")
+
+	_, err := r.Table("books").
+		Filter(r.Row.Field("BookID").Eq(BookID)).
+		Update(map[string]interface{}{
+			"RatingCount": visible.Count(),
+			"RatingAvg":   visible.Avg().Default(0),
+		}, r.UpdateOpts{NonAtomic: true}).
+		RunWrite(rc.Session)
+	if err != nil {
+		log.Println("Error refreshing book rating:", err)
+		return err
+	}
+
+	return nil
+}
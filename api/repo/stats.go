@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"fmt"
+	"log"
+	"rethink/api/models"
+	"time"
+
+	r "github.com/rethinkdb/rethinkdb-go"
+)
+
+// StatsController struct computes catalog statistics in RethinkDB
+type StatsController struct {
+	Session *r.Session
+}
+
+// NewStatsController initializes the StatsController with a RethinkDB session
+func NewStatsController(Session *r.Session) *StatsController {
+	return &StatsController{Session: Session}
+}
+
+// GetStats computes the catalog report. Book figures are limited to books
+// created (or, for recent updates, updated) within [from, to); a zero time
+// leaves that side of the range open.
+func (sc *StatsController) GetStats(from, to time.Time) (*models.Stats, error) {
+
+	stats := &models.Stats{}
+	if !from.IsZero() {
+		stats.From = &from
+	}
+	if !to.IsZero() {
+		stats.To = &to
+	}
+
+	books := r.Table("books").Filter(inRange("CreatedAt", from, to))
+
+	if err := sc.readOne(books.Count(), &stats.TotalBooks); err != nil {
+		return nil, err
+	}
+
+	var months []struct {
+		Group     []int ` rethinkdb:"group" `
+		Reduction int   ` rethinkdb:"reduction" `
+	}
+	err := sc.readAll(books.
+		Group(func(book r.Term) interface{} {
+			return []interface{}{book.Field("CreatedAt").Year(), book.Field("CreatedAt").Month()}
+		}).
+		Count().
+		Ungroup().
+		OrderBy(r.Asc("group")), &months)
+	if err != nil {
+		return nil, err
+	}
+	stats.BooksPerMonth = make([]models.MonthCount, 0, len(months))
+	for _, month := range months {
+		if len(month.Group) != 2 {
+			continue
+		}
+		stats.BooksPerMonth = append(stats.BooksPerMonth, models.MonthCount{
+			Month: fmt.Sprintf("%04d-%02d", month.Group[0], month.Group[1]),
+			Count: month.Reduction,
+		})
+	}
+
+	stats.TopContributors = []models.Contributor{}
+	err = sc.readAll(books.
+		Group("CreatedBy").
+		Count().
+		Ungroup().
+		OrderBy(r.Desc("reduction")).
+		Limit(10).
+		Map(func(group r.Term) interface{} {
+			return map[string]interface{}{
+				"userid": group.Field("group"),
+				"name": r.Table("users").
+					Filter(map[string]interface{}{"userid": group.Field("group")}).
+					Nth(0).Field("name").Default(""),
+				"count": group.Field("reduction"),
+			}
+		}), &stats.TopContributors)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.UsersByRole = []models.RoleCount{}
+	err = sc.readAll(r.Table("users").
+		Group("role").
+		Count().
+		Ungroup().
+		OrderBy(r.Asc("group")), &stats.UsersByRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var activity struct {
+		Active   int ` rethinkdb:"active" `
+		Inactive int ` rethinkdb:"inactive" `
+	}
+	users := r.Table("users")
+	err = sc.readOne(r.Expr(map[string]interface{}{
+		"active":   users.Filter(r.Row.Field("active").Default(false).Eq(true)).Count(),
+		"inactive": users.Filter(r.Row.Field("active").Default(false).Eq(false)).Count(),
+	}), &activity)
+	if err != nil {
+		return nil, err
+	}
+	stats.ActiveUsers = activity.Active
+	stats.InactiveUsers = activity.Inactive
+
+	stats.RecentlyUpdated = []models.Books{}
+	err = sc.readAll(r.Table("books").
+		Filter(inRange("UpdatedAt", from, to)).
+		OrderBy(r.Desc("UpdatedAt")).
+		Limit(10), &stats.RecentlyUpdated)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// inRange builds a filter matching documents whose time field lies in [from, to)
+func inRange(field string, from, to time.Time) interface{} {
+	return func(doc r.Term) interface{} {
+		cond := r.Expr(true)
+		if !from.IsZero() {
+			cond = cond.And(doc.Field(field).Ge(from))
+		}
+		if !to.IsZero() {
+			cond = cond.And(doc.Field(field).Lt(to))
+		}
+		return cond
+	}
+}
+
+// readOne runs a query returning a single value and decodes it into dest
+func (sc *StatsController) readOne(query r.Term, dest interface{}) error {
+	cursor, err := query.Run(sc.Session)
+	if err != nil {
+		log.Println("Error computing stats:", err)
+		return err
+	}
+	defer cursor.Close()
+
+	return cursor.One(dest)
+}
+
+// readAll runs a query returning a sequence and decodes it into dest
+func (sc *StatsController) readAll(query r.Term, dest interface{}) error {
+	cursor, err := query.Run(sc.Session)
+	if err != nil {
+		log.Println("Error computing stats:", err)
+		return err
+	}
+	defer cursor.Close()
+
+	return cursor.All(dest)
+}
@@ -3,8 +3,11 @@ package repo
 import (
 	"errors"
 	"fmt"
+	"log"
+	"regexp"
 	"rethink/api/db"
 	"rethink/api/models"
+	"time"
 
 	r "github.com/rethinkdb/rethinkdb-go"
 )
@@ -61,54 +64,299 @@ func (uc *UserController) GetAllUsers() ([]models.AppUser, error) {
 	return users, nil
 }
 
-// GetUserByID fetches a user from the database by ID
-func (uc *UserController) GetUserByEmail(Email string) (*models.AppUser, error) {
+// SearchUsers fetches a page of users whose name or email contains the query,
+// ordered by name, along with the total number of matches. Password hashes are
+// never returned.
+func (uc *UserController) SearchUsers(query string, page, limit int) ([]models.AppUser, int, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	users := r.Table("users")
+	if query != "" {
+		pattern := "(?i)" + regexp.QuoteMeta(query)
+		users = users.Filter(func(user r.Term) interface{} {
+			return user.Field("name").Default("").Match(pattern).
+				Or(user.Field("email").Default("").Match(pattern))
+		})
+	}
+
+	var total int
+	if err := users.Count().ReadOne(&total, uc.session); err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := users.
+		OrderBy(r.Asc("name")).
+		Skip((page - 1) * limit).
+		Limit(limit).
+		Without("password").
+		Run(uc.session)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close()
+
+	result := []models.AppUser{}
+	if err := cursor.All(&result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+// GetUserByUserid fetches a user from the database by their Userid
+func (uc *UserController) GetUserByUserid(Userid string) (*models.AppUser, error) {
 	var user models.AppUser
 
-	err := r.DB("taipan").Table("users").Filter(r.Row.Field("Email").Eq(Email)).ReadOne(&user, db.DB)
+	err := r.Table("users").Filter(r.Row.Field("userid").Eq(Userid)).ReadOne(&user, uc.session)
 	if err != nil {
-		fmt.Println("Error fetching from DB : ", err)
-		return nil, err
+		return nil, errors.New("user not found")
 	}
 
 	return &user, nil
 }
 
-// UpdateUser updates user information
-func (uc *UserController) UpdateUser(Email string, updatedUser models.AppUser) error {
+// GetRoles fetches every role ordered by level
+func (uc *UserController) GetRoles() ([]models.Roles, error) {
+	cursor, err := r.Table("roles").OrderBy(r.Asc("level")).Run(uc.session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var roles []models.Roles
+	if err := cursor.All(&roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// RoleExists checks that a role is defined in the roles table
+func (uc *UserController) RoleExists(role string) (bool, error) {
+	var count int
+
+	err := r.Table("roles").Filter(r.Row.Field("role").Eq(role)).Count().ReadOne(&count, uc.session)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetRolePrivileges lists the privileges granted to a role
+func (uc *UserController) GetRolePrivileges(role string) ([]string, error) {
+	cursor, err := r.Table("access").
+		Filter(r.Row.Field("role").Eq(role)).
+		OrderBy(r.Asc("privilege")).
+		Field("privilege").
+		Run(uc.session)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
 
-	// Fetch the existing user
-	existingUser, err := uc.GetUserByEmail(Email)
+	privileges := []string{}
+	if err := cursor.All(&privileges); err != nil {
+		return nil, err
+	}
+	return privileges, nil
+}
+
+// SetUserRole changes a user's role after checking it exists in the roles table
+func (uc *UserController) SetUserRole(Userid, role string) error {
+	exists, err := uc.RoleExists(role)
 	if err != nil {
-		return err // Return error if user is not found
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("unknown role: %s", role)
 	}
 
-	// Ensure `createdat` is not overwritten by preserving its original value
-	updatedUser.CreatedAt = existingUser.CreatedAt
-	updatedUser.Userid = existingUser.Userid
+	return uc.updateByUserid(Userid, map[string]interface{}{"role": role})
+}
 
-	_, err = r.Table("users").Filter(r.Row.Field("Email").Eq(Email)).Update(updatedUser, r.UpdateOpts{NonAtomic: true}).RunWrite(uc.session)
+// SetUserDisabled deactivates or reactivates a user's account. Deactivated
+// accounts can't log in; deactivating also marks the user as logged out.
+func (uc *UserController) SetUserDisabled(Userid string, disabled bool) error {
+	fields := map[string]interface{}{"disabled": disabled}
+	if disabled {
+		fields["active"] = false
+	}
+
+	return uc.updateByUserid(Userid, fields)
+}
+
+// MarkEmailVerified records that a user has confirmed their email address
+func (uc *UserController) MarkEmailVerified(Userid string) error {
+	return uc.updateByUserid(Userid, map[string]interface{}{"emailverified": true})
+}
+
+// SetPassword hashes and stores a new password for a user
+func (uc *UserController) SetPassword(Userid, password string) error {
+	return uc.updateByUserid(Userid, map[string]interface{}{"password": db.HashPassword(password)})
+}
+
+// SetTOTPSecret stores a new, not yet confirmed, encrypted TOTP secret
+func (uc *UserController) SetTOTPSecret(Userid, secret string) error {
+	return uc.updateByUserid(Userid, map[string]interface{}{
+		"totpsecret":   secret,
+		"totpenabled":  false,
+		"totplaststep": 0,
+	})
+}
+
+// EnableTOTP turns on two-factor authentication with the hashed recovery codes
+func (uc *UserController) EnableTOTP(Userid string, step int64, recoveryCodes []string) error {
+	return uc.updateByUserid(Userid, map[string]interface{}{
+		"totpenabled":   true,
+		"totplaststep":  step,
+		"recoverycodes": recoveryCodes,
+	})
+}
+
+// DisableTOTP turns off two-factor authentication and forgets the secret
+func (uc *UserController) DisableTOTP(Userid string) error {
+	return uc.updateByUserid(Userid, map[string]interface{}{
+		"totpenabled":   false,
+		"totpsecret":    "",
+		"totplaststep":  0,
+		"recoverycodes": []string{},
+	})
+}
+
+// SetRecoveryCodes replaces a user's hashed recovery codes
+func (uc *UserController) SetRecoveryCodes(Userid string, recoveryCodes []string) error {
+	return uc.updateByUserid(Userid, map[string]interface{}{"recoverycodes": recoveryCodes})
+}
+
+// UseTOTPStep records the time step of an accepted code so it can't be
+// replayed. It fails if that step or a later one was already used.
+func (uc *UserController) UseTOTPStep(Userid string, step int64) error {
+	res, err := r.Table("users").
+		Filter(r.Row.Field("userid").Eq(Userid).And(r.Row.Field("totplaststep").Default(0).Lt(step))).
+		Update(map[string]interface{}{"totplaststep": step}).
+		RunWrite(uc.session)
 	if err != nil {
 		return err
 	}
+	if res.Replaced == 0 {
+		return errors.New("code already used")
+	}
 	return nil
 }
 
-// DeleteUser removes a user from the database
-func (uc *UserController) DeleteUser(Email string) error {
-	// Check if the user exists
-	cursor, err := r.Table("users").Filter(r.Row.Field("Email").Eq(Email)).Run(uc.session)
+// UseRecoveryCode removes a hashed recovery code from the user, failing if
+// the user doesn't have it. Each code works once.
+func (uc *UserController) UseRecoveryCode(Userid, hash string) error {
+	res, err := r.Table("users").
+		Filter(r.Row.Field("userid").Eq(Userid).And(r.Row.Field("recoverycodes").Default([]string{}).Contains(hash))).
+		Update(map[string]interface{}{"recoverycodes": r.Row.Field("recoverycodes").SetDifference([]string{hash})}).
+		RunWrite(uc.session)
 	if err != nil {
-		return fmt.Errorf("error fetching user: %v", err)
+		return err
 	}
-	defer cursor.Close()
+	if res.Replaced == 0 {
+		return errors.New("invalid recovery code")
+	}
+	return nil
+}
 
-	if cursor.IsNil() {
-		return fmt.Errorf("user not found")
+// SetUserActive records whether a user is currently logged in
+func (uc *UserController) SetUserActive(Userid string, active bool) error {
+	return uc.updateByUserid(Userid, map[string]interface{}{"active": active})
+}
+
+// updateByUserid applies a partial update to a user and bumps UpdatedAt
+func (uc *UserController) updateByUserid(Userid string, fields map[string]interface{}) error {
+	fields["updatedat"] = time.Now()
+
+	res, err := r.Table("users").Filter(r.Row.Field("userid").Eq(Userid)).Update(fields).RunWrite(uc.session)
+	if err != nil {
+		return err
+	}
+
+	if res.Replaced == 0 && res.Unchanged == 0 {
+		return errors.New("user not found")
 	}
 
-	//delete
-	res, err := r.Table("users").Filter(r.Row.Field("Email").Eq(Email)).Delete().RunWrite(uc.session)
+	return nil
+}
+
+// GetUserByID fetches a user from the database by ID
+func (uc *UserController) GetUserByEmail(Email string) (*models.AppUser, error) {
+	var user models.AppUser
+
+	err := r.DB("taipan").Table("users").Filter(r.Row.Field("Email").Eq(Email)).ReadOne(&user, db.DB)
+	if err != nil {
+		fmt.Println("Error fetching from DB : ", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateUser applies a partial update to a user's profile and returns the
+// updated user. Only the given fields change.
+func (uc *UserController) UpdateUser(Userid string, fields map[string]interface{}) (*models.AppUser, error) {
+	if len(fields) > 0 {
+		if err := uc.updateByUserid(Userid, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	return uc.GetUserByUserid(Userid)
+}
+
+// DeleteUser removes a user together with their reviews and reading lists.
+// Their books are either transferred to transferTo or anonymized, depending
+// on booksOption. The deletion is recorded in the user audit table.
+func (uc *UserController) DeleteUser(Userid, booksOption, transferTo, performedBy string) error {
+	user, err := uc.GetUserByUserid(Userid)
+	if err != nil {
+		return err
+	}
+
+	newOwner := models.DeletedUser
+	detail := "books anonymized"
+	switch booksOption {
+	case models.BooksAnonymize, "":
+	case models.BooksTransfer:
+		if transferTo == Userid {
+			return errors.New("books can't be transferred to the deleted user")
+		}
+		if _, err := uc.GetUserByUserid(transferTo); err != nil {
+			return errors.New("user to transfer books to not found")
+		}
+		newOwner = transferTo
+		detail = "books transferred to " + transferTo
+	default:
+		return fmt.Errorf("unknown books option: %s", booksOption)
+	}
+
+	// Books are stored under the Go field names of models.Books
+	for _, field := range []string{"CreatedBy", "UpdatedBy"} {
+		_, err = r.Table("books").
+			Filter(r.Row.Field(field).Eq(Userid)).
+			Update(map[string]interface{}{field: newOwner}).
+			RunWrite(uc.session)
+		if err != nil {
+			log.Println("Error reassigning books of deleted user:", err)
+			return err
+		}
+	}
+
+	if err := uc.deleteReviews(Userid); err != nil {
+		return err
+	}
+
+	_, err = r.Table("reading_lists").Filter(r.Row.Field("userid").Eq(Userid)).Delete().RunWrite(uc.session)
+	if err != nil {
+		log.Println("Error deleting reading lists of user:", err)
+		return err
+	}
+
+	res, err := r.Table("users").Filter(r.Row.Field("userid").Eq(Userid)).Delete().RunWrite(uc.session)
 	if err != nil {
 		return err
 	}
@@ -118,9 +366,52 @@ func (uc *UserController) DeleteUser(Email string) error {
 		return fmt.Errorf("user not found or already deleted")
 	}
 
+	uc.audit(user, "delete", detail, performedBy)
+	return nil
+}
+
+// deleteReviews removes a user's reviews and refreshes the ratings they counted towards
+func (uc *UserController) deleteReviews(Userid string) error {
+	var bookIDs []int
+	err := r.Table("reviews").Filter(r.Row.Field("userid").Eq(Userid)).Field("bookid").ReadAll(&bookIDs, uc.session)
+	if err != nil {
+		log.Println("Error fetching reviews of user:", err)
+		return err
+	}
+
+	_, err = r.Table("reviews").Filter(r.Row.Field("userid").Eq(Userid)).Delete().RunWrite(uc.session)
+	if err != nil {
+		log.Println("Error deleting reviews of user:", err)
+		return err
+	}
+
+	rc := NewReviewController(uc.session)
+	for _, BookID := range bookIDs {
+		if err := rc.RefreshRating(BookID); err != nil {
+			log.Println("Error refreshing rating after deleting reviews:", err)
+		}
+	}
+
 	return nil
 }
 
+// audit writes an entry to the user audit table. Failures are logged rather
+// than returned since the action itself has already happened.
+func (uc *UserController) audit(user *models.AppUser, action, detail, performedBy string) {
+	entry := models.UserAudit{
+		Userid:      user.Userid,
+		Email:       user.Email,
+		Action:      action,
+		Detail:      detail,
+		PerformedBy: performedBy,
+		At:          time.Now(),
+	}
+
+	if _, err := r.Table("user_audit").Insert(entry).RunWrite(uc.session); err != nil {
+		log.Println("Error writing user audit entry:", err)
+	}
+}
+
 // GetUserRoleByEmail fetches the role of a user by email
 func (uc *UserController) GetUserRoleByEmail(Email string) (string, error) {
 
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"rethink/api/db"
+	"rethink/api/handlers"
+	"rethink/api/middleware"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminRoutes initializes the Admin user-management API endpoints
+func AdminRoutes(e *echo.Echo) {
+
+	dbInstance := db.InitDB()
+	uc := repo.NewUserController(dbInstance)
+
+	e.GET("/users", handlers.ListUsers(uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "user_manage"))
+	e.GET("/users/:id", handlers.AdminGetUser(uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "user_manage"))
+	e.PUT("/users/:id/role", handlers.AdminSetRole(uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "user_manage"))
+	e.PUT("/users/:id/active", handlers.AdminSetActive(uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "user_manage"))
+	e.POST("/users/:id/logout", handlers.AdminForceLogout(uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "user_manage"))
+	e.POST("/users/:id/unlock", handlers.AdminUnlockUser(uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "user_manage"))
+	e.DELETE("/users/:id", handlers.AdminDeleteUser(uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "user_manage"))
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"rethink/api/db"
+	"rethink/api/handlers"
+	"rethink/api/middleware"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AuthorRoutes initializes author API endpoints
+func AuthorRoutes(e *echo.Echo) {
+
+	dbInstance := db.InitDB()
+	ac := repo.NewAuthorController(dbInstance)
+	uc := repo.NewUserController(dbInstance)
+
+	e.GET("/authors", handlers.GetAuthors(ac), middleware.AuthMiddleware, middleware.CheckAccess(uc, "book_read"))
+	e.GET("/authors/:id", handlers.GetAuthor(ac), middleware.AuthMiddleware, middleware.CheckAccess(uc, "book_read"))
+	e.POST("/authors", handlers.CreateAuthor(ac), middleware.AuthMiddleware, middleware.CheckAccess(uc, "author_create"))
+	e.PUT("/authors/:id", handlers.UpdateAuthor(ac), middleware.AuthMiddleware, middleware.CheckAccess(uc, "author_update"))
+	e.DELETE("/authors/:id", handlers.DeleteAuthor(ac), middleware.AuthMiddleware, middleware.CheckAccess(uc, "author_delete"))
+	e.POST("/authors/:id/merge", handlers.MergeAuthor(ac), middleware.AuthMiddleware, middleware.CheckAccess(uc, "author_merge"))
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"rethink/api/db"
+	"rethink/api/handlers"
+	"rethink/api/middleware"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CopyRoutes initializes physical copy and inventory API endpoints
+func CopyRoutes(e *echo.Echo) {
+
+	dbInstance := db.InitDB()
+	cc := repo.NewCopyController(dbInstance)
+	bc := repo.NewBookController(dbInstance)
+	uc := repo.NewUserController(dbInstance)
+
+	e.GET("/books/:id/copies", handlers.GetCopies(cc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "book_read"))
+	e.POST("/books/:id/copies", handlers.CreateCopy(cc, bc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "copy_create"))
+	e.GET("/copies/:id", handlers.GetCopy(cc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "book_read"))
+	e.PUT("/copies/:id", handlers.UpdateCopy(cc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "copy_update"))
+	e.PUT("/copies/:id/status", handlers.SetCopyStatus(cc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "copy_update"))
+	e.DELETE("/copies/:id", handlers.DeleteCopy(cc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "copy_delete"))
+	e.GET("/copies/:id/audit", handlers.GetCopyAudit(cc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "copy_update"))
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"rethink/api/db"
+	"rethink/api/handlers"
+	"rethink/api/middleware"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExportRoutes initializes the personal data export endpoints
+func ExportRoutes(e *echo.Echo) {
+
+	dbInstance := db.InitDB()
+	uc := repo.NewUserController(dbInstance)
+	ec := repo.NewExportController(dbInstance)
+
+	e.POST("/profile/export", handlers.StartExport(uc, ec), middleware.SessionAuth)
+	e.GET("/profile/export/:id", handlers.ExportStatus(), middleware.SessionAuth)
+
+	// Download links are signed and expire, so they work without a session
+	e.GET("/exports/:id", handlers.DownloadExport())
+}
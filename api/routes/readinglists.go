@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"rethink/api/db"
+	"rethink/api/handlers"
+	"rethink/api/middleware"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListRoutes initializes reading list API endpoints
+func ListRoutes(e *echo.Echo) {
+
+	dbInstance := db.InitDB()
+	lc := repo.NewListController(dbInstance)
+	bc := repo.NewBookController(dbInstance)
+
+	e.GET("/lists", handlers.GetLists(lc), middleware.SessionAuth)
+	e.POST("/lists", handlers.CreateList(lc), middleware.SessionAuth)
+	e.GET("/lists/:id", handlers.GetList(lc), middleware.SessionAuth)
+	e.PUT("/lists/:id", handlers.UpdateList(lc), middleware.SessionAuth)
+	e.DELETE("/lists/:id", handlers.DeleteList(lc), middleware.SessionAuth)
+	e.POST("/lists/:id/books", handlers.AddListBook(lc, bc), middleware.SessionAuth)
+	e.DELETE("/lists/:id/books/:bookid", handlers.RemoveListBook(lc), middleware.SessionAuth)
+	e.PUT("/lists/:id/order", handlers.ReorderList(lc), middleware.SessionAuth)
+	e.GET("/lists/shared/:token", handlers.GetSharedList(lc))
+}
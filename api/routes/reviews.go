@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"rethink/api/db"
+	"rethink/api/handlers"
+	"rethink/api/middleware"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReviewRoutes initializes book review API endpoints
+func ReviewRoutes(e *echo.Echo) {
+
+	dbInstance := db.InitDB()
+	rc := repo.NewReviewController(dbInstance)
+	bc := repo.NewBookController(dbInstance)
+	uc := repo.NewUserController(dbInstance)
+
+	e.GET("/books/:id/reviews", handlers.GetReviews(rc, uc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "book_read"))
+	e.PUT("/books/:id/reviews", handlers.SaveReview(rc, bc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "review_create"))
+	e.PUT("/reviews/:id/hide", handlers.HideReview(rc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "review_moderate"))
+}
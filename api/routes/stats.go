@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"rethink/api/db"
+	"rethink/api/handlers"
+	"rethink/api/middleware"
+	"rethink/api/repo"
+
+	"github.com/labstack/echo/v4"
+)
+
+// StatsRoutes initializes the Admin-only catalog statistics endpoint
+func StatsRoutes(e *echo.Echo) {
+
+	dbInstance := db.InitDB()
+	sc := repo.NewStatsController(dbInstance)
+	uc := repo.NewUserController(dbInstance)
+
+	e.GET("/stats", handlers.GetStats(sc), middleware.AuthMiddleware, middleware.CheckAccess(uc, "stats_read"))
+}
@@ -14,10 +14,24 @@ func UserRoutes(e *echo.Echo) {
 	dbInstance := db.InitDB()
 	uc := repo.NewUserController(dbInstance)
 
-	e.POST("/register", handlers.Register(uc))                                      //register
-	e.POST("/login", handlers.Login(uc))                                            //login
-	e.GET("/logout", handlers.Logout(uc), middleware.AuthMiddleware)                //logout
-	e.GET("/profile", handlers.GetUser(uc), middleware.AuthMiddleware)              //read user
-	e.PUT("/profile/:email", handlers.UpdateUser(uc), middleware.AuthMiddleware)    //update user
-	e.DELETE("/profile/:email", handlers.DeleteUser(uc), middleware.AuthMiddleware) //delete user
+	e.POST("/register", handlers.Register(uc))                                            //register
+	e.POST("/login", handlers.Login(uc))                                                  //login
+	e.POST("/token/refresh", handlers.RefreshToken(uc))                                   //refresh tokens
+	e.GET("/.well-known/jwks.json", handlers.JWKS())                                      //public signing keys
+	e.GET("/logout", handlers.Logout(uc), middleware.LogoutAuth)                          //logout
+	e.GET("/profile", handlers.GetUser(uc), middleware.SessionAuth)                       //read user
+	e.PUT("/profile/:email", handlers.UpdateUser(uc), middleware.SessionAuth)             //update user
+	e.PATCH("/profile/:email", handlers.UpdateUser(uc), middleware.SessionAuth)           //partially update user
+	e.PUT("/profile/password", handlers.ChangePassword(uc), middleware.SessionAuth)       //change password
+	e.DELETE("/profile/:email", handlers.DeleteUser(uc), middleware.SessionAuth)          //delete user
+	e.GET("/profile/sessions", handlers.ListSessions(), middleware.SessionAuth)           //list sessions
+	e.DELETE("/profile/sessions", handlers.RevokeOtherSessions(), middleware.SessionAuth) //log out other sessions
+	e.DELETE("/profile/sessions/:id", handlers.RevokeSession(), middleware.SessionAuth)   //log out a session
+	e.POST("/profile/2fa/setup", handlers.SetupTOTP(uc), middleware.SessionAuth)          //start 2FA setup
+	e.POST("/profile/2fa/enable", handlers.EnableTOTP(uc), middleware.SessionAuth)        //confirm 2FA setup
+	e.POST("/profile/2fa/codes", handlers.NewRecoveryCodes(uc), middleware.SessionAuth)   //new recovery codes
+	e.DELETE("/profile/2fa", handlers.DisableTOTP(uc), middleware.SessionAuth)            //turn off 2FA
+	e.GET("/profile/tokens", handlers.ListAPITokens(), middleware.SessionAuth)            //list API tokens
+	e.POST("/profile/tokens", handlers.CreateAPIToken(uc), middleware.SessionAuth)        //create API token
+	e.DELETE("/profile/tokens/:id", handlers.RevokeAPIToken(), middleware.SessionAuth)    //revoke API token
 }
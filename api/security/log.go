@@ -0,0 +1,44 @@
+package security
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+var logger = log.New(os.Stderr, "security: ", log.LstdFlags)
+
+// InitSecurityLog sends security events to the file in SECURITY_LOG from
+// config.json. Without it they go to stderr.
+func InitSecurityLog() {
+	path := viper.GetString("SECURITY_LOG")
+	if path == "" {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatal("Failed to open security log:", err)
+	}
+	SetOutput(file)
+}
+
+// SetOutput redirects the security log, e.g. to a buffer in tests
+func SetOutput(w io.Writer) {
+	logger.SetOutput(w)
+}
+
+// Event records a security event with key/value details, e.g.
+// Event("login_lockout", "email", email, "ip", ip)
+func Event(name string, details ...string) {
+	var b strings.Builder
+	b.WriteString("event=" + name)
+	for i := 0; i+1 < len(details); i += 2 {
+		fmt.Fprintf(&b, " %s=%q", details[i], details[i+1])
+	}
+	logger.Println(b.String())
+}
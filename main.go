@@ -1,30 +1,57 @@
 package main
 
 import (
+	"rethink/api/auth"
 	"rethink/api/db"
 	"rethink/api/handlers"
+	"rethink/api/mail"
+	"rethink/api/middleware"
 	"rethink/api/repo"
 	"rethink/api/routes"
+	"rethink/api/security"
 
 	"github.com/labstack/echo/v4"
 )
 
 func main() {
 	dbinstance := db.InitDB()
-	db.InitRedis()
+	db.InitSessionStore()
+	db.InitPasswordPolicy()
+	mail.InitMailer()
+	security.InitSecurityLog()
+	auth.InitKeys()
 
 	e := echo.New()
+	e.Use(middleware.CSRF())
 	//e.Static("/", "static")
 	e.Static("/api/web", "./api/web")
 
 	userController := repo.NewUserController(dbinstance)
 	bookController := repo.NewBookController(dbinstance)
+	reviewController := repo.NewReviewController(dbinstance)
+	listController := repo.NewListController(dbinstance)
+	statsController := repo.NewStatsController(dbinstance)
+	authorController := repo.NewAuthorController(dbinstance)
+	exportController := repo.NewExportController(dbinstance)
 
 	handlers.UserRoute(e, userController)
-	handlers.BooksRoute(e, bookController)
+	handlers.BooksRoute(e, bookController, userController)
+	handlers.ReviewsRoute(e, reviewController, bookController, userController)
+	handlers.ListsRoute(e, listController, bookController)
+	handlers.StatsRoute(e, statsController, userController)
+	handlers.AuthorsRoute(e, authorController, userController)
+	handlers.AdminRoute(e, userController)
+	handlers.ExportRoute(e, userController, exportController)
 
 	routes.UserRoutes(e)
 	routes.BookRoutes(e)
+	routes.ReviewRoutes(e)
+	routes.ListRoutes(e)
+	routes.StatsRoutes(e)
+	routes.AuthorRoutes(e)
+	routes.CopyRoutes(e)
+	routes.AdminRoutes(e)
+	routes.ExportRoutes(e)
 
 	e.GET("/", handlers.Home)
 